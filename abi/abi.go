@@ -0,0 +1,287 @@
+// Package abi 编码合约调用的函数选择器与参数，并解码合约的返回数据。
+//
+// 调用数据由若干 32 字节的大端序槽位组成，与 CALLDATALOAD 的读取方式一致：
+// 第一个槽位是函数选择器，之后每个参数占一个槽位。bytes 参数的槽位中是其内容相对参数区起点的偏移量，
+// 内容放在所有参数槽位之后，先是一个长度槽位，再是补齐到槽位整数倍的数据。
+//
+// 合约可以用 PUSH 0、CALLDATALOAD 读出选择器，再用 JEQ 按选择器分派；第 i 个参数位于 32*(i+1)。
+//
+// 返回数据是合约用 STORE 写入内存再 RETURN 的内容，其槽位宽度等于 VM 的位宽，
+// 因此 Unpack 需要给出执行时的 vm.WordSize，编码方式与参数相同。
+package abi
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"neochain/common"
+	"neochain/utils"
+	"neochain/vm"
+	"strings"
+)
+
+// SlotSize 是调用数据中每个槽位的字节数
+const SlotSize = vm.CallDataSlot
+
+var (
+	ErrInvalidArgument  = errors.New("abi: invalid argument")
+	ErrInvalidData      = errors.New("abi: invalid data")
+	ErrSelectorMismatch = errors.New("abi: selector mismatch")
+)
+
+// minInt256 与 maxInt256 是 Int 能编码的范围 [-2^255, 2^255-1]
+var (
+	minInt256 = new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 255))
+	maxInt256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(1))
+)
+
+// Type 是参数或返回值的类型
+type Type int
+
+const (
+	Uint  Type = iota // 无符号整数，编码时接受 uint64、int、common.Word 与 *big.Int，解码为 common.Word
+	Int               // 有符号整数，以槽位宽度的补码编码，编码时接受 int64、int 与 *big.Int，解码为 *big.Int
+	Bool              // 0 或 1，编码时接受 bool，解码为 bool
+	Bytes             // 变长字节串，编码时接受 []byte 与 string，解码为 []byte
+)
+
+func (t Type) String() string {
+	switch t {
+	case Uint:
+		return "uint"
+	case Int:
+		return "int"
+	case Bool:
+		return "bool"
+	case Bytes:
+		return "bytes"
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// Method 描述合约的一个函数
+type Method struct {
+	Name    string
+	Inputs  []Type
+	Outputs []Type
+}
+
+// Signature 返回函数的规范签名，例如 transfer(uint,uint)
+func (m Method) Signature() string {
+	names := make([]string, len(m.Inputs))
+	for i, t := range m.Inputs {
+		names[i] = t.String()
+	}
+	return m.Name + "(" + strings.Join(names, ",") + ")"
+}
+
+// Selector 返回函数选择器：签名的 SHA-256 的前 4 字节
+func (m Method) Selector() uint32 {
+	sum := sha256.Sum256([]byte(m.Signature()))
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+// Pack 编码调用该函数的调用数据
+func (m Method) Pack(args ...interface{}) ([]byte, error) {
+	data, err := Encode(m.Inputs, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", m.Name, err)
+	}
+	selector := make([]byte, SlotSize)
+	binary.BigEndian.PutUint32(selector[SlotSize-4:], m.Selector())
+	return append(selector, data...), nil
+}
+
+// UnpackInput 解码调用该函数的调用数据，选择器不匹配时返回 ErrSelectorMismatch
+func (m Method) UnpackInput(data []byte) ([]interface{}, error) {
+	if len(data) < SlotSize {
+		return nil, fmt.Errorf("%w: call data shorter than a selector", ErrInvalidData)
+	}
+	selector := utils.BytesToWord(data[:SlotSize])
+	if !selector.IsUint64() || selector.Uint64() != uint64(m.Selector()) {
+		return nil, fmt.Errorf("%w: got %s, want %#x", ErrSelectorMismatch, selector.Hex(), m.Selector())
+	}
+	return Decode(m.Inputs, data[SlotSize:])
+}
+
+// Unpack 解码该函数在位宽为 size 的 VM 中执行后的返回数据。
+// 与 VM 一样，vm.Word256 以外的位宽（包括零值）都按 64 位处理
+func (m Method) Unpack(size vm.WordSize, data []byte) ([]interface{}, error) {
+	slot := 8
+	if size == vm.Word256 {
+		slot = 32
+	}
+	values, err := decode(slot, m.Outputs, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", m.Name, err)
+	}
+	return values, nil
+}
+
+// Encode 按 32 字节的槽位编码参数，不含选择器
+func Encode(types []Type, args ...interface{}) ([]byte, error) {
+	return encode(SlotSize, types, args)
+}
+
+// Decode 是 Encode 的逆过程
+func Decode(types []Type, data []byte) ([]interface{}, error) {
+	return decode(SlotSize, types, data)
+}
+
+func encode(slot int, types []Type, args []interface{}) ([]byte, error) {
+	if len(args) != len(types) {
+		return nil, fmt.Errorf("%w: %d arguments for %d parameters", ErrInvalidArgument, len(args), len(types))
+	}
+	head := make([]byte, 0, slot*len(types))
+	tail := make([]byte, 0)
+	for i, t := range types {
+		if t == Bytes {
+			b, err := toBytes(args[i])
+			if err != nil {
+				return nil, fmt.Errorf("argument %d: %w", i, err)
+			}
+			head = append(head, putUint(slot, uint64(slot*len(types)+len(tail)))...)
+			tail = append(tail, putUint(slot, uint64(len(b)))...)
+			tail = append(tail, b...)
+			if pad := len(b) % slot; pad != 0 {
+				tail = append(tail, make([]byte, slot-pad)...)
+			}
+			continue
+		}
+		w, err := toWord(t, args[i])
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		b := utils.WordToBytes(w)
+		if !fitsSlot(t, b, slot) {
+			return nil, fmt.Errorf("argument %d: %w: %v does not fit in %d bytes", i, ErrInvalidArgument, args[i], slot)
+		}
+		b = b[32-slot:]
+		head = append(head, b...)
+	}
+	return append(head, tail...), nil
+}
+
+func decode(slot int, types []Type, data []byte) ([]interface{}, error) {
+	if len(data) < slot*len(types) {
+		return nil, fmt.Errorf("%w: %d bytes for %d values", ErrInvalidData, len(data), len(types))
+	}
+	values := make([]interface{}, len(types))
+	for i, t := range types {
+		b := data[slot*i : slot*(i+1)]
+		w := utils.BytesToWord(b)
+		switch t {
+		case Uint:
+			values[i] = w
+		case Int:
+			v := new(big.Int).SetBytes(b)
+			if b[0]&0x80 != 0 {
+				v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(8*slot)))
+			}
+			values[i] = v
+		case Bool:
+			if w != common.NewWord(0) && w != common.NewWord(1) {
+				return nil, fmt.Errorf("%w: value %d is not a bool", ErrInvalidData, i)
+			}
+			values[i] = w == common.NewWord(1)
+		case Bytes:
+			v, err := decodeBytes(slot, data, w)
+			if err != nil {
+				return nil, fmt.Errorf("value %d: %w", i, err)
+			}
+			values[i] = v
+		default:
+			return nil, fmt.Errorf("%w: unknown type %v", ErrInvalidData, t)
+		}
+	}
+	return values, nil
+}
+
+// decodeBytes 读取偏移量 offset 处的长度槽位及其后的内容
+func decodeBytes(slot int, data []byte, offset common.Word) ([]byte, error) {
+	size := uint64(len(data))
+	if !offset.IsUint64() || offset.Uint64() > size || size-offset.Uint64() < uint64(slot) {
+		return nil, fmt.Errorf("%w: bytes offset %s out of range", ErrInvalidData, offset)
+	}
+	start := offset.Uint64() + uint64(slot)
+	length := utils.BytesToWord(data[offset.Uint64():start])
+	if !length.IsUint64() || length.Uint64() > size-start {
+		return nil, fmt.Errorf("%w: bytes length %s out of range", ErrInvalidData, length)
+	}
+	return append([]byte{}, data[start:start+length.Uint64()]...), nil
+}
+
+// fitsSlot 判断 32 字节的编码 b 能否无损地截断为最后 slot 字节：
+// 无符号数要求截掉的字节全为 0，有符号数要求截掉的字节全为符号位
+func fitsSlot(t Type, b []byte, slot int) bool {
+	var fill byte
+	if t == Int && b[32-slot]&0x80 != 0 {
+		fill = 0xff
+	}
+	for _, c := range b[:32-slot] {
+		if c != fill {
+			return false
+		}
+	}
+	return true
+}
+
+func toWord(t Type, arg interface{}) (common.Word, error) {
+	switch t {
+	case Uint:
+		switch v := arg.(type) {
+		case uint64:
+			return common.NewWord(v), nil
+		case int:
+			if v >= 0 {
+				return common.NewWord(uint64(v)), nil
+			}
+		case common.Word:
+			return v, nil
+		case *big.Int:
+			if v.Sign() >= 0 && v.BitLen() <= 256 {
+				return common.WordFromBig(v), nil
+			}
+		}
+	case Int:
+		switch v := arg.(type) {
+		case int64:
+			return common.WordFromBig(big.NewInt(v)), nil
+		case int:
+			return common.WordFromBig(big.NewInt(int64(v))), nil
+		case *big.Int:
+			if v.Cmp(minInt256) >= 0 && v.Cmp(maxInt256) <= 0 {
+				return common.WordFromBig(v), nil
+			}
+		}
+	case Bool:
+		if v, ok := arg.(bool); ok {
+			if v {
+				return common.NewWord(1), nil
+			}
+			return common.NewWord(0), nil
+		}
+	default:
+		return common.Word{}, fmt.Errorf("%w: unknown type %v", ErrInvalidArgument, t)
+	}
+	return common.Word{}, fmt.Errorf("%w: cannot encode %T %v as %v", ErrInvalidArgument, arg, arg, t)
+}
+
+func toBytes(arg interface{}) ([]byte, error) {
+	switch v := arg.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("%w: cannot encode %T as bytes", ErrInvalidArgument, arg)
+}
+
+// putUint 将 v 编码为一个大端序槽位
+func putUint(slot int, v uint64) []byte {
+	b := make([]byte, slot)
+	binary.BigEndian.PutUint64(b[slot-8:], v)
+	return b
+}
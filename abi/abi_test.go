@@ -0,0 +1,196 @@
+package abi
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"neochain/common"
+	"neochain/vm"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	types := []Type{Uint, Int, Bool, Bytes, Uint, Bytes}
+	big256, _ := new(big.Int).SetString("0xffffffffffffffffffffffffffffffffffffffffffffffff0000000000000001", 0)
+	data, err := Encode(types, 7, -5, true, []byte("hello, world, this spans two slots!"), big256, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 6 个参数槽位，之后是两个 bytes 各自的长度槽位与内容
+	if want := 32*6 + 32 + 64 + 32; len(data) != want {
+		t.Errorf("encoded %d bytes, want %d", len(data), want)
+	}
+	values, err := Decode(types, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{
+		common.NewWord(7),
+		big.NewInt(-5),
+		true,
+		[]byte("hello, world, this spans two slots!"),
+		common.WordFromBig(big256),
+		[]byte{},
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("decoded %v, want %v", values, want)
+	}
+
+	// 8 字节槽位与 64 位 VM 写出的返回数据一致
+	narrow, err := encode(8, []Type{Uint, Int}, []interface{}{uint64(1) << 63, -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "8000000000000000ffffffffffffffff"; fmt.Sprintf("%x", narrow) != want {
+		t.Errorf("narrow encoding %x, want %s", narrow, want)
+	}
+	tooWide := []struct {
+		typ Type
+		arg interface{}
+	}{
+		{Uint, big256},
+		{Int, new(big.Int).Lsh(big.NewInt(-1), 64)},
+		{Int, new(big.Int).Lsh(big.NewInt(1), 63)},
+	}
+	for _, c := range tooWide {
+		if _, err := encode(8, []Type{c.typ}, []interface{}{c.arg}); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("%v %v in 8 bytes: got %v", c.typ, c.arg, err)
+		}
+	}
+
+	// int256 的最小值可以编码并原样解码，超出 [-2^255, 2^255-1] 的值被拒绝
+	lowest := new(big.Int).Lsh(big.NewInt(-1), 255)
+	if data, err := Encode([]Type{Int}, lowest); err != nil {
+		t.Errorf("encode -2^255: %v", err)
+	} else if got, err := Decode([]Type{Int}, data); err != nil || !reflect.DeepEqual(got, []interface{}{lowest}) {
+		t.Errorf("decode -2^255: got %v, %v", got, err)
+	}
+
+	bad := []struct {
+		name  string
+		types []Type
+		args  []interface{}
+	}{
+		{"count", []Type{Uint}, nil},
+		{"int below range", []Type{Int}, []interface{}{new(big.Int).Sub(lowest, big.NewInt(1))}},
+		{"int above range", []Type{Int}, []interface{}{new(big.Int).Lsh(big.NewInt(1), 255)}},
+		{"negative uint", []Type{Uint}, []interface{}{-1}},
+		{"bool type", []Type{Bool}, []interface{}{1}},
+		{"bytes type", []Type{Bytes}, []interface{}{42}},
+	}
+	for _, c := range bad {
+		if _, err := Encode(c.types, c.args...); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("%s: got %v", c.name, err)
+		}
+	}
+	corrupt := append([]byte{}, data...)
+	corrupt[32*3+31] = 0xff // bytes 的偏移量超出数据
+	if _, err := Decode(types, corrupt); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("corrupt offset: got %v", err)
+	}
+	if _, err := Decode([]Type{Bool}, make([]byte, 31)); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("short data: got %v", err)
+	}
+}
+
+func TestMethod(t *testing.T) {
+	transfer := Method{Name: "transfer", Inputs: []Type{Uint, Uint, Bytes}}
+	if sig := transfer.Signature(); sig != "transfer(uint,uint,bytes)" {
+		t.Errorf("signature %s", sig)
+	}
+	data, err := transfer.Pack(1, 2, []byte("memo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := transfer.UnpackInput(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{common.NewWord(1), common.NewWord(2), []byte("memo")}; !reflect.DeepEqual(values, want) {
+		t.Errorf("unpacked %v, want %v", values, want)
+	}
+	// 零值的位宽与 VM 一样按 64 位解码
+	balance := Method{Name: "balance", Outputs: []Type{Int}}
+	if got, err := balance.Unpack(0, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}); err != nil || !reflect.DeepEqual(got, []interface{}{big.NewInt(-2)}) {
+		t.Errorf("unpack with zero word size: %v, %v", got, err)
+	}
+	other := Method{Name: "transfer", Inputs: []Type{Uint, Uint}}
+	if _, err := other.UnpackInput(data); !errors.Is(err, ErrSelectorMismatch) {
+		t.Errorf("other overload: got %v", err)
+	}
+}
+
+// TestContract 部署一个按选择器分派的合约，用不同的调用数据调用它并解码返回数据
+func TestContract(t *testing.T) {
+	add := Method{Name: "add", Inputs: []Type{Uint, Uint}, Outputs: []Type{Uint}}
+	lt := Method{Name: "lt", Inputs: []Type{Uint, Uint}, Outputs: []Type{Bool, Uint}}
+	// N 为一个栈元素写入内存的字节数，返回数据的槽位宽度与之相同
+	src := `
+		PUSH 0
+		CALLDATALOAD
+		JEQ add, ADD
+		JEQ lt, LT
+		REVERT
+	add:
+		PUSH 32
+		CALLDATALOAD
+		PUSH 64
+		CALLDATALOAD
+		ADD
+		STORE 0
+		PUSH N
+		PUSH 0
+		RETURN
+	lt:
+		PUSH 32
+		CALLDATALOAD
+		PUSH 64
+		CALLDATALOAD
+		LT
+		STORE 0
+		PUSH 64
+		CALLDATALOAD
+		STORE N
+		PUSH N2
+		PUSH 0
+		RETURN
+	`
+
+	for _, size := range []vm.WordSize{vm.Word64, vm.Word256} {
+		n := int(size) / 8
+		consts := fmt.Sprintf(".const ADD %d\n.const LT %d\n.const N %d\n.const N2 %d\n", add.Selector(), lt.Selector(), n, 2*n)
+		code, err := vm.Assemble(consts + src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		engine := vm.NewVM(make([]byte, 64))
+		engine.WordSize = size
+		deployed, err := engine.ExecuteTransaction(&common.Transaction{Type: common.TxDeploy, Code: code, GasLimit: common.DefaultGasLimit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		invoke := func(m Method, args ...interface{}) ([]interface{}, error) {
+			data, err := m.Pack(args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := engine.ExecuteTransaction(&common.Transaction{Type: common.TxInvoke, To: deployed.ContractAddress, Data: data, GasLimit: common.DefaultGasLimit})
+			if err != nil {
+				return nil, err
+			}
+			return m.Unpack(size, result.ReturnData)
+		}
+
+		if got, err := invoke(add, 40, 2); err != nil || !reflect.DeepEqual(got, []interface{}{common.NewWord(42)}) {
+			t.Errorf("%d-bit add: %v, %v", size, got, err)
+		}
+		if got, err := invoke(lt, 3, 9); err != nil || !reflect.DeepEqual(got, []interface{}{true, common.NewWord(9)}) {
+			t.Errorf("%d-bit lt: %v, %v", size, got, err)
+		}
+		unknown := Method{Name: "mul", Inputs: []Type{Uint, Uint}}
+		if _, err := invoke(unknown, 1, 2); !errors.Is(err, vm.ErrExecutionReverted) {
+			t.Errorf("%d-bit unknown selector: %v", size, err)
+		}
+	}
+}
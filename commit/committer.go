@@ -1,7 +1,7 @@
 package commit
 
 import (
-	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
@@ -12,24 +12,37 @@ import (
 	"neochain/common"
 	"neochain/utils"
 	"neochain/vm"
+	"path/filepath"
 	"sync"
 	"time"
 )
 
+// DefaultTxLimits 是 Committer 执行每个交易时默认的资源限制。
+// 共识路径上的限制必须是确定性的：gas 上限不超过 common.MaxGasLimit，再加上指令条数上限
+var DefaultTxLimits = vm.Limits{MaxSteps: 1 << 22}
+
 type Committer struct {
 	BlockDB *leveldb.DB
 	StateDB *leveldb.DB
 
+	// TxLimits 限制区块中每个交易的执行，防止单个交易长时间占用 commitMutex。
+	// MaxSteps 与 gas 一样是确定性的，超出的交易在所有节点上都作为失败交易记录。
+	// Timeout 取决于本节点的负载，不能决定交易的结果，executeBlock 执行时忽略它
+	TxLimits vm.Limits
+
 	commitMutex sync.Mutex
-	wmapMutex   sync.Mutex
 }
 
 func NewCommitter(chainID string) *Committer {
-	blockDB, err := leveldb.OpenFile(fmt.Sprintf("tmp/my-raft-cluster/%s/blockdb.leveldb", chainID), nil)
+	return newCommitter(fmt.Sprintf("tmp/my-raft-cluster/%s", chainID))
+}
+
+func newCommitter(dir string) *Committer {
+	blockDB, err := leveldb.OpenFile(filepath.Join(dir, "blockdb.leveldb"), nil)
 	if err != nil {
 		log.Fatalf("failed to open block db: %s", err)
 	}
-	stateDB, err := leveldb.OpenFile(fmt.Sprintf("tmp/my-raft-cluster/%s/statedb.leveldb", chainID), nil)
+	stateDB, err := leveldb.OpenFile(filepath.Join(dir, "statedb.leveldb"), nil)
 	if err != nil {
 		log.Fatalf("failed to open state db: %s", err)
 	}
@@ -43,59 +56,104 @@ func NewCommitter(chainID string) *Committer {
 	}
 
 	commiter := &Committer{
-		BlockDB: blockDB,
-		StateDB: stateDB,
+		BlockDB:  blockDB,
+		StateDB:  stateDB,
+		TxLimits: DefaultTxLimits,
 	}
-	commiter.storeBlock(0, genesisBlock, make([]byte, 1024))
+	commiter.storeBlock(0, genesisBlock, nil, nil)
 	return commiter
 }
 
-func (c *Committer) CommitBlock(msg common.CommitMsg) []*common.TxDefMsg {
+// CommitBlock 执行并保存区块，返回需要重新排队的中止交易。
+// ctx 被取消时区块没有执行完，不保存任何内容并返回 ctx 的错误
+func (c *Committer) CommitBlock(ctx context.Context, msg common.CommitMsg) ([]*common.TxDefMsg, error) {
 	c.commitMutex.Lock()
 	defer c.commitMutex.Unlock()
 
 	log.Printf("performance statistic: exe[s][%d]: %v", msg.Height, time.Now().UnixNano())
-	abortedTxs, successTxs, err, lastBlock, engine := c.executeBlock(msg)
+	res, err := c.executeBlock(ctx, msg)
 	if err != nil {
-		log.Fatalf("failed to execute block: %s", err)
+		return nil, fmt.Errorf("failed to execute block[%d]: %w", msg.Height, err)
 	}
 	log.Printf("performance statistic: exe[e][%d]: %v", msg.Height, time.Now().UnixNano())
+	log.Printf("block[%d] gas used: %d", msg.Height, res.gasUsed)
 
 	log.Printf("performance statistic: commit[s][%d]: %v", msg.Height, time.Now().UnixNano())
 	block := &common.Block{
 		Header: common.BlockHeader{
 			Height:        msg.Height,
-			PrevBlockHash: lastBlock.Header.BlockHash,
+			PrevBlockHash: res.lastBlock.Header.BlockHash,
 			BlockHash:     "",
+			GasUsed:       res.gasUsed,
+			Timestamp:     msg.Timestamp,
 		},
-		Txs: successTxs,
+		Txs:       res.successTxs,
+		FailedTxs: res.failedTxs,
 	}
-	c.storeBlock(msg.Height, block, engine.Context.Memory.Cell)
+	c.storeBlock(msg.Height, block, res.writes, res.receipts)
 	log.Printf("performance statistic: commit[e][%d]: %v", msg.Height, time.Now().UnixNano())
 
-	return abortedTxs
+	return res.abortedTxs, nil
 }
 
-func (c *Committer) storeBlock(height int, block *common.Block, state []byte) {
+// storeBlock 保存区块及其交易回执，并把区块内所有的状态写入原子地写入 StateDB
+func (c *Committer) storeBlock(height int, block *common.Block, writes map[string][]byte, receipts []common.Receipt) {
 	curHeightBin := make([]byte, 8)
 	binary.BigEndian.PutUint64(curHeightBin, uint64(height))
 	blockBytes := calBlockHash(block)
-	err := c.StateDB.Put(curHeightBin, state, nil)
+	batch := new(leveldb.Batch)
+	for key, value := range writes {
+		batch.Put([]byte(statePrefix+key), value)
+	}
+	err := c.StateDB.Write(batch, nil)
 	if err != nil {
-		log.Fatalf("failed to put block: %s", err)
+		log.Fatalf("failed to put state: %s", err)
 	}
-	err = c.BlockDB.Put(curHeightBin, blockBytes, nil)
+	receiptBytes, err := json.Marshal(receipts)
+	if err != nil {
+		log.Fatalf("failed to marshal receipts: %s", err)
+	}
+	blockBatch := new(leveldb.Batch)
+	blockBatch.Put(curHeightBin, blockBytes)
+	blockBatch.Put(receiptsKey(height), receiptBytes)
+	err = c.BlockDB.Write(blockBatch, nil)
 	if err != nil {
 		log.Fatalf("failed to put block: %s", err)
 	}
 }
 
+// GetReceipts 返回高度为 height 的区块中所有已执行交易的回执，按交易在批次中的顺序排列
+func (c *Committer) GetReceipts(height int) ([]common.Receipt, error) {
+	receiptBytes, err := c.BlockDB.Get(receiptsKey(height), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get receipts[%d]: %w", height, err)
+	}
+	var receipts []common.Receipt
+	if err := json.Unmarshal(receiptBytes, &receipts); err != nil {
+		return nil, fmt.Errorf("failed to read receipts[%d]: %w", height, err)
+	}
+	return receipts, nil
+}
+
+// receiptsKey 返回区块回执在 BlockDB 中的键
+func receiptsKey(height int) []byte {
+	key := []byte("receipts/")
+	return binary.BigEndian.AppendUint64(key, uint64(height))
+}
+
+// calBlockHash 计算 BlockHash 为空时区块的哈希，写入 block.Header.BlockHash，
+// 返回带有哈希的区块编码
 func calBlockHash(block *common.Block) []byte {
+	block.Header.BlockHash = ""
 	blockBytes, err := json.Marshal(block)
 	if err != nil {
 		log.Fatalf("failed to marshal block: %s", err)
 	}
 	block.Header.BlockHash = hex.EncodeToString(calHash(blockBytes))
+	blockBytes, err = json.Marshal(block)
+	if err != nil {
+		log.Fatalf("failed to marshal block: %s", err)
+	}
 	return blockBytes
 }
 
@@ -117,7 +175,35 @@ func calTxHash(uid int, txDef *common.TxDefMsg) []byte {
 	return calHash(allBytes)
 }
 
-func (c *Committer) executeBlock(msg common.CommitMsg) ([]*common.TxDefMsg, []common.TxDefMsg, error, common.Block, *vm.VM) {
+// blockResult 是执行一个区块得到的结果
+type blockResult struct {
+	abortedTxs []*common.TxDefMsg // 实际访问超出预测、需要重新排队的交易
+	successTxs []common.TxDefMsg
+	failedTxs  []common.TxDefMsg
+	lastBlock  common.Block
+	writes     map[string][]byte // 合并所有成功交易之后的状态写入
+	receipts   []common.Receipt  // 成功与失败交易的回执，按批次顺序排列
+	gasUsed    uint64
+}
+
+// txOutcome 是单个交易在独立上下文中执行的结果
+type txOutcome struct {
+	aborted bool
+	err     error
+	result  *vm.ExecutionResult
+	state   *vm.OverlayState // 交易成功时持有它的全部状态写入
+}
+
+// executeBlock 执行区块中的交易。
+// 执行前先静态分析每个交易可能访问的状态位置，再用 planGroups 将批次划分为互不冲突的组。
+// 组按顺序执行，同一组内的交易并行执行，每个交易在自己的 VM 上下文中执行，
+// 状态是之前各组成功交易的写入与上一区块状态之上的私有写缓冲；
+// 每组执行完成后按批次顺序合并成功交易的写入，结果与按批次顺序串行执行相同，与调度无关。
+// 实际访问超出预测的交易被中止并重新排队（例如调用了同一区块中先部署的合约）。
+// 每个交易的执行受 c.TxLimits 中确定性的限制约束，超出 gas 或指令条数上限的交易作为失败交易记录；
+// ctx 被取消时结果不完整，返回错误，不产生区块。
+// 环境操作码读到的区块时间来自 msg.Timestamp，交易的发送方为 IdxFrom，它由客户端填写，没有经过认证。
+func (c *Committer) executeBlock(ctx context.Context, msg common.CommitMsg) (*blockResult, error) {
 	lastHeightBin := make([]byte, 8)
 	if msg.Height == 0 {
 		log.Fatalf("In CommitBlock: Height must greater than 0.")
@@ -133,63 +219,149 @@ func (c *Committer) executeBlock(msg common.CommitMsg) ([]*common.TxDefMsg, []co
 		log.Fatalf("failed to read last block: %s", err)
 	}
 
-	snapshot, err := c.StateDB.Get(lastHeightBin, nil)
+	snapshot := stateSnapshot{c.StateDB}
+	prevHash, err := hex.DecodeString(lastBlock.Header.BlockHash)
 	if err != nil {
-		log.Fatalf("failed to open snapshot: %s", err)
+		log.Fatalf("invalid hash of block[%d]: %s", msg.Height-1, err)
+	}
+	var blockTime uint64
+	if msg.Timestamp > 0 {
+		blockTime = uint64(msg.Timestamp)
+	}
+	blockContext := func(i int, txDef *common.TxDefMsg) vm.BlockContext {
+		return vm.BlockContext{
+			Height:    uint64(msg.Height),
+			Timestamp: blockTime,
+			PrevHash:  prevHash,
+			TxHash:    calTxHash(i, txDef),
+			Caller:    common.NewWord(uint64(txDef.IdxFrom)), // 客户端填写，未经认证
+		}
 	}
-	engine := vm.NewVM(snapshot)
-
-	successTxs := make([]common.TxDefMsg, 0)
-	abortedTxs := make([]*common.TxDefMsg, 0)
 
-	wmap := make(map[int][]byte)
+	// 第一阶段并行分析每个交易的读写集，无法分析的交易视为可能访问任何位置
+	sets := make([]*vm.AccessSet, len(msg.Batch))
 	wg := sync.WaitGroup{}
 	wg.Add(len(msg.Batch))
-	mu := sync.Mutex{}
 	for i, txDef := range msg.Batch {
-		go func(localTxDef *common.TxDefMsg, localI int) {
+		go func(localI int, localTxDef *common.TxDefMsg) {
 			defer wg.Done()
-			selfHash := calTxHash(localI, localTxDef)
-			mu.Lock()
-			defer mu.Unlock()
-
-			if val, ok := wmap[localTxDef.IdxTo]; !ok || bytes.Compare(val, selfHash) > 0 {
-				wmap[localTxDef.IdxTo] = selfHash
+			engine := vm.NewVMWithState(snapshot)
+			engine.Block = blockContext(localI, localTxDef)
+			set, err := engine.Analyze(utils.TxDefMsgToTransaction(localTxDef))
+			if err != nil {
+				set = &vm.AccessSet{Any: true}
 			}
-		}(txDef, i)
+			sets[localI] = set
+		}(i, txDef)
 	}
-	wg.Wait() // 第一阶段预执行同步
-	wg.Add(len(msg.Batch))
-	for i, txDef := range msg.Batch {
-		go func(localI int, localTxDef *common.TxDefMsg) {
-			defer wg.Done()
-			selfHash := calTxHash(localI, localTxDef)
-			if c.checkConcurrent(wmap, localTxDef, selfHash, abortedTxs) {
-				return
+	wg.Wait() // 第一阶段分析同步
+	groups := planGroups(sets)
+
+	res := &blockResult{
+		abortedTxs: make([]*common.TxDefMsg, 0),
+		successTxs: make([]common.TxDefMsg, 0),
+		failedTxs:  make([]common.TxDefMsg, 0),
+		lastBlock:  lastBlock,
+		writes:     make(map[string][]byte),
+		receipts:   make([]common.Receipt, 0),
+	}
+
+	// 第二阶段逐组执行，组内的 goroutine 只读 state，每个 goroutine 只写自己的 outcomes[i]
+	limits := c.TxLimits
+	limits.Timeout = 0
+	outcomes := make([]txOutcome, len(msg.Batch))
+	state := &blockState{writes: res.writes, base: snapshot}
+	for _, group := range groups {
+		wg.Add(len(group))
+		for _, i := range group {
+			go func(localI int, localTxDef *common.TxDefMsg) {
+				defer wg.Done()
+				outcome := &outcomes[localI]
+
+				// gas 上限过高、校验或执行失败的交易不会留下任何状态，作为失败交易记录在区块中
+				tx := utils.TxDefMsgToTransaction(localTxDef)
+				if outcome.err = tx.CheckGasLimit(); outcome.err != nil {
+					return
+				}
+				if outcome.err = vm.Verify(tx.Code); outcome.err != nil {
+					return
+				}
+				outcome.state = vm.NewOverlayState(state)
+				engine := vm.NewVMWithState(outcome.state)
+				engine.Block = blockContext(localI, localTxDef)
+				outcome.result, outcome.err = engine.ExecuteTransactionContext(ctx, tx, limits)
+				if outcome.result != nil && !sets[localI].Covers(outcome.result.StateReadSet, outcome.result.StateWriteSet) {
+					log.Printf("transaction %v accessed state outside its predicted set %s; aborting", localTxDef, sets[localI])
+					outcome.aborted = true
+				}
+			}(i, msg.Batch[i])
+		}
+		wg.Wait() // 组内执行同步
+
+		for _, i := range group {
+			if outcome := outcomes[i]; !outcome.aborted && outcome.err == nil {
+				keys, values := outcome.state.Writes()
+				for j, key := range keys {
+					res.writes[key] = values[j]
+				}
 			}
+		}
+	}
 
-			tx := utils.TxDefMsgToTransaction(localTxDef)
-			innerErr := engine.ExecuteTransaction(tx)
-			if innerErr != nil {
-				log.Fatalf("failed to execute transaction: %s", err)
+	// ctx 被取消时部分交易可能被中断，它们的结果不能写入区块
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for i, outcome := range outcomes {
+		txDef := msg.Batch[i]
+		if outcome.aborted {
+			res.abortedTxs = append(res.abortedTxs, txDef)
+			continue
+		}
+		receipt := common.Receipt{
+			Height: msg.Height,
+			Index:  i,
+			TxHash: hex.EncodeToString(calTxHash(i, txDef)),
+			Status: common.ReceiptSuccess,
+			Logs:   make([]common.Log, 0),
+		}
+		if outcome.result != nil {
+			res.gasUsed += outcome.result.GasUsed
+			receipt.GasUsed = outcome.result.GasUsed
+		}
+		if outcome.err != nil {
+			log.Printf("transaction %v failed: %s", txDef, outcome.err)
+			res.failedTxs = append(res.failedTxs, *txDef)
+			receipt.Status = common.ReceiptFailed
+			receipt.Error = outcome.err.Error()
+		} else {
+			res.successTxs = append(res.successTxs, *txDef)
+			receipt.ContractAddress = outcome.result.ContractAddress
+			if outcome.result.Logs != nil {
+				receipt.Logs = outcome.result.Logs
 			}
-			successTxs = append(successTxs, *localTxDef)
-		}(i, txDef)
+		}
+		res.receipts = append(res.receipts, receipt)
 	}
-	wg.Wait() // 第二阶段冲突处理同步
-	return nil, successTxs, err, lastBlock, engine
+	return res, nil
 }
 
-func (c *Committer) checkConcurrent(wmap map[int][]byte, localTxDef *common.TxDefMsg, selfHash []byte, abortedTxs []*common.TxDefMsg) bool {
-	c.wmapMutex.Lock()
-	defer c.wmapMutex.Unlock()
-	if val, ok := wmap[localTxDef.IdxTo]; ok && bytes.Compare(val, selfHash) < 0 {
-		abortedTxs = append(abortedTxs, localTxDef)
-		return true
-	}
-	if val, ok := wmap[localTxDef.IdxFrom]; ok && bytes.Compare(val, selfHash) < 0 {
-		abortedTxs = append(abortedTxs, localTxDef)
-		return true
+// planGroups 按预测的读写集将批次划分为若干组，同一组内的交易互不冲突，可以并行执行。
+// 每个交易所在的组都排在批次中位于它之前、与它冲突的所有交易所在的组之后，
+// 因此按组的顺序执行与按批次顺序串行执行的结果相同
+func planGroups(sets []*vm.AccessSet) [][]int {
+	level := make([]int, len(sets))
+	groups := make([][]int, 0)
+	for i := range sets {
+		for j := 0; j < i; j++ {
+			if level[j] >= level[i] && sets[i].Conflicts(sets[j]) {
+				level[i] = level[j] + 1
+			}
+		}
+		if level[i] == len(groups) {
+			groups = append(groups, nil)
+		}
+		groups[level[i]] = append(groups[level[i]], i)
 	}
-	return false
+	return groups
 }
@@ -0,0 +1,347 @@
+package commit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"neochain/common"
+	"neochain/utils"
+	"neochain/vm"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dumpState(t *testing.T, c *Committer) map[string]string {
+	state := make(map[string]string)
+	it := c.StateDB.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		state[string(it.Key())] = fmt.Sprintf("%x", it.Value())
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func heightKey(height int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(height))
+	return key
+}
+
+// TestCommitBlockDeterministic 在两个独立的 Committer 上提交相同的批次，
+// 每个区块的状态与区块内容都必须完全一致
+func TestCommitBlockDeterministic(t *testing.T) {
+	a := newCommitter(t.TempDir())
+	b := newCommitter(t.TempDir())
+	defer a.BlockDB.Close()
+	defer a.StateDB.Close()
+	defer b.BlockDB.Close()
+	defer b.StateDB.Close()
+
+	rnd := rand.New(rand.NewSource(1))
+	for height := 1; height <= 3; height++ {
+		batch := make([]*common.TxDefMsg, 32)
+		for i := range batch {
+			batch[i] = &common.TxDefMsg{IdxFrom: rnd.Intn(4), IdxTo: rnd.Intn(4), Work: 1000}
+		}
+		abortedA, errA := a.CommitBlock(context.Background(), common.CommitMsg{Batch: batch, Height: height})
+		abortedB, errB := b.CommitBlock(context.Background(), common.CommitMsg{Batch: batch, Height: height})
+		if errA != nil || errB != nil {
+			t.Fatalf("height %d: %v, %v", height, errA, errB)
+		}
+		if len(abortedA) != len(abortedB) {
+			t.Fatalf("height %d: aborted %d vs %d", height, len(abortedA), len(abortedB))
+		}
+		if height == 3 && len(dumpState(t, a)) == 0 {
+			t.Fatalf("no state was written")
+		}
+
+		for _, key := range [][]byte{heightKey(height)} {
+			va, err := a.BlockDB.Get(key, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vb, err := b.BlockDB.Get(key, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(va, vb) {
+				t.Errorf("height %d: block differs between committers", height)
+			}
+		}
+		if sa, sb := dumpState(t, a), dumpState(t, b); !reflect.DeepEqual(sa, sb) {
+			t.Errorf("height %d: state differs between committers:\n%v\n%v", height, sa, sb)
+		}
+	}
+}
+
+func TestReceipts(t *testing.T) {
+	c := newCommitter(t.TempDir())
+	defer c.BlockDB.Close()
+	defer c.StateDB.Close()
+
+	logging := &common.Transaction{
+		Code: []common.Opcode{
+			{Name: "PUSH", Args: []interface{}{uint64(3)}},
+			{Name: "PUSH", Args: []interface{}{uint64(4)}},
+			{Name: "PUSH", Args: []interface{}{uint64(0)}},
+			{Name: "LOG1"},
+		},
+		GasLimit: common.DefaultGasLimit,
+	}
+	reverting := &common.Transaction{
+		Code:     []common.Opcode{{Name: "REVERT"}},
+		GasLimit: common.DefaultGasLimit,
+	}
+	batch := []*common.TxDefMsg{
+		{IdxFrom: 0, IdxTo: 1, Tx: logging},
+		{IdxFrom: 2, IdxTo: 3, Tx: reverting},
+	}
+	if aborted, err := c.CommitBlock(context.Background(), common.CommitMsg{Batch: batch, Height: 1}); err != nil || len(aborted) != 0 {
+		t.Fatalf("%d transactions aborted: %v", len(aborted), err)
+	}
+
+	receipts, err := c.GetReceipts(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receipts) != 2 {
+		t.Fatalf("got %d receipts, want 2", len(receipts))
+	}
+	ok, failed := receipts[0], receipts[1]
+	if ok.Status != common.ReceiptSuccess || ok.Height != 1 || ok.Index != 0 || ok.GasUsed == 0 || ok.TxHash == "" {
+		t.Errorf("unexpected receipt %+v", ok)
+	}
+	if want := []common.Log{{Topics: []common.Word{common.NewWord(3)}, Data: make([]byte, 4)}}; !reflect.DeepEqual(ok.Logs, want) {
+		t.Errorf("logs %+v, want %+v", ok.Logs, want)
+	}
+	if failed.Status != common.ReceiptFailed || failed.Index != 1 || failed.Error == "" || len(failed.Logs) != 0 {
+		t.Errorf("unexpected receipt %+v", failed)
+	}
+}
+
+// TestTxLimits 中不会结束的交易在超过指令条数上限后作为失败交易记录，不会卡住提交；
+// gas 上限超过 MaxGasLimit 的交易不会执行，同样作为失败交易记录
+func TestTxLimits(t *testing.T) {
+	c := newCommitter(t.TempDir())
+	defer c.BlockDB.Close()
+	defer c.StateDB.Close()
+	c.TxLimits = vm.Limits{MaxSteps: 1000, Timeout: time.Minute}
+
+	spin := &common.Transaction{
+		Code:     []common.Opcode{{Name: "JMP", Args: []interface{}{0}}},
+		GasLimit: common.MaxGasLimit,
+	}
+	greedy := &common.Transaction{
+		Code:     []common.Opcode{{Name: "WORK", Args: []interface{}{uint64(math.MaxUint64)}}},
+		GasLimit: math.MaxUint64,
+	}
+	batch := []*common.TxDefMsg{
+		{IdxFrom: 0, IdxTo: 1, Tx: spin},
+		{IdxFrom: 2, IdxTo: 3},
+		{IdxFrom: 4, IdxTo: 5, Tx: greedy},
+	}
+	if aborted, err := c.CommitBlock(context.Background(), common.CommitMsg{Batch: batch, Height: 1}); err != nil || len(aborted) != 0 {
+		t.Fatalf("%d transactions aborted: %v", len(aborted), err)
+	}
+	receipts, err := c.GetReceipts(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipts[0].Status != common.ReceiptFailed || !strings.Contains(receipts[0].Error, vm.ErrStepLimit.Error()) {
+		t.Errorf("spinning transaction: %+v", receipts[0])
+	}
+	if receipts[1].Status != common.ReceiptSuccess {
+		t.Errorf("ordinary transaction: %+v", receipts[1])
+	}
+	if receipts[2].Status != common.ReceiptFailed || receipts[2].GasUsed != 0 || !strings.Contains(receipts[2].Error, common.ErrGasLimitTooHigh.Error()) {
+		t.Errorf("transaction over MaxGasLimit: %+v", receipts[2])
+	}
+}
+
+// TestTxTimeout 中共识路径忽略墙钟时间上限，超过它的交易照常执行
+func TestTxTimeout(t *testing.T) {
+	c := newCommitter(t.TempDir())
+	defer c.BlockDB.Close()
+	defer c.StateDB.Close()
+	c.TxLimits = vm.Limits{MaxSteps: 1000, Timeout: time.Millisecond}
+
+	slow := &common.Transaction{
+		Code:     []common.Opcode{{Name: "WORK", Args: []interface{}{(common.DefaultGasLimit - vm.GasWork) * vm.WorkPerGas}}},
+		GasLimit: common.DefaultGasLimit,
+	}
+	batch := []*common.TxDefMsg{{IdxFrom: 0, IdxTo: 1, Tx: slow}}
+	res, err := c.executeBlock(context.Background(), common.CommitMsg{Batch: batch, Height: 1})
+	if err != nil || len(res.successTxs) != 1 {
+		t.Fatalf("slow transaction: %v, %d succeeded", err, len(res.successTxs))
+	}
+
+	// ctx 被取消时不提交区块，也不终止进程
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.CommitBlock(ctx, common.CommitMsg{Batch: batch, Height: 1}); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled commit: got %v", err)
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, 1)
+	if ok, _ := c.BlockDB.Has(key, nil); ok {
+		t.Errorf("cancelled commit stored block 1")
+	}
+}
+
+// TestBlockEnvironment 中交易读到的区块时间来自 CommitMsg，PREVHASH 为上一区块保存的哈希
+func TestBlockEnvironment(t *testing.T) {
+	c := newCommitter(t.TempDir())
+	defer c.BlockDB.Close()
+	defer c.StateDB.Close()
+
+	env := &common.Transaction{
+		Code: []common.Opcode{
+			{Name: "HEIGHT"},
+			{Name: "PUSH", Args: []interface{}{uint64(0)}},
+			{Name: "SSTORE", Args: []interface{}{[]byte("height")}},
+			{Name: "TIMESTAMP"},
+			{Name: "PUSH", Args: []interface{}{uint64(0)}},
+			{Name: "SSTORE", Args: []interface{}{[]byte("time")}},
+			{Name: "PREVHASH"},
+			{Name: "PUSH", Args: []interface{}{uint64(0)}},
+			{Name: "SSTORE", Args: []interface{}{[]byte("prev")}},
+			{Name: "CALLER"},
+			{Name: "PUSH", Args: []interface{}{uint64(0)}},
+			{Name: "SSTORE", Args: []interface{}{[]byte("caller")}},
+		},
+		GasLimit: common.DefaultGasLimit,
+	}
+	for height := 1; height <= 2; height++ {
+		batch := []*common.TxDefMsg{{IdxFrom: 5, IdxTo: 6, Tx: env}}
+		if _, err := c.CommitBlock(context.Background(), common.CommitMsg{Batch: batch, Height: height, Timestamp: int64(1700000000 + height)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	blocks := make([]common.Block, 3)
+	for height := range blocks {
+		data, err := c.BlockDB.Get(heightKey(height), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &blocks[height]); err != nil {
+			t.Fatal(err)
+		}
+		// 保存的哈希是 BlockHash 为空时区块编码的哈希
+		unhashed := blocks[height]
+		unhashed.Header.BlockHash = ""
+		encoded, _ := json.Marshal(unhashed)
+		if sum := sha256.Sum256(encoded); blocks[height].Header.BlockHash != hex.EncodeToString(sum[:]) {
+			t.Errorf("block %d: stored hash %q does not match its contents", height, blocks[height].Header.BlockHash)
+		}
+		if height > 0 && blocks[height].Header.PrevBlockHash != blocks[height-1].Header.BlockHash {
+			t.Errorf("block %d: prev hash %q, want %q", height, blocks[height].Header.PrevBlockHash, blocks[height-1].Header.BlockHash)
+		}
+	}
+	if blocks[2].Header.Timestamp != 1700000002 {
+		t.Errorf("block timestamp %d", blocks[2].Header.Timestamp)
+	}
+
+	state := dumpState(t, c)
+	prev, _ := hex.DecodeString(blocks[1].Header.BlockHash)
+	want := map[string]string{
+		"height[0]": "0000000000000002",
+		"time[0]":   fmt.Sprintf("%016x", 1700000002),
+		"prev[0]":   hex.EncodeToString(prev[24:]), // 64 位模式只保留低 64 位
+		"caller[0]": "0000000000000005",
+	}
+	for key, value := range want {
+		if got := state[statePrefix+key]; got != value {
+			t.Errorf("%s = %s, want %s", key, got, value)
+		}
+	}
+}
+
+// TestPlannedExecution 中按组并行执行的结果必须与按批次顺序串行执行相同
+func TestPlannedExecution(t *testing.T) {
+	c := newCommitter(t.TempDir())
+	defer c.BlockDB.Close()
+	defer c.StateDB.Close()
+
+	serial := vm.NewMemState()
+	rnd := rand.New(rand.NewSource(2))
+	for height := 1; height <= 3; height++ {
+		batch := make([]*common.TxDefMsg, 24)
+		for i := range batch {
+			batch[i] = &common.TxDefMsg{IdxFrom: rnd.Intn(6), IdxTo: rnd.Intn(6), Work: 100}
+			if _, err := vm.NewVMWithState(serial).ExecuteTransaction(utils.TxDefMsgToTransaction(batch[i])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if aborted, err := c.CommitBlock(context.Background(), common.CommitMsg{Batch: batch, Height: height}); err != nil || len(aborted) != 0 {
+			t.Fatalf("height %d: %d transactions aborted: %v", height, len(aborted), err)
+		}
+	}
+	state := dumpState(t, c)
+	if len(state) != len(serial) {
+		t.Fatalf("%d keys, want %d", len(state), len(serial))
+	}
+	for key, value := range serial {
+		if got := state[statePrefix+key]; got != fmt.Sprintf("%x", value) {
+			t.Errorf("%s = %s, want %x", key, got, value)
+		}
+	}
+
+	// 同一批次中的交易两两冲突时，每个交易自成一组
+	sets := make([]*vm.AccessSet, 3)
+	for i := range sets {
+		var err error
+		if sets[i], err = vm.NewVM(nil).Analyze(common.NewTransaction(i, i+1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if groups := planGroups(sets); !reflect.DeepEqual(groups, [][]int{{0}, {1}, {2}}) {
+		t.Errorf("chain of conflicts planned as %v", groups)
+	}
+	sets[2], _ = vm.NewVM(nil).Analyze(common.NewTransaction(4, 5))
+	if groups := planGroups(sets); !reflect.DeepEqual(groups, [][]int{{0, 2}, {1}}) {
+		t.Errorf("independent transaction planned as %v", groups)
+	}
+}
+
+// TestMispredictedAccess 中调用同一区块内部署的合约时，分析看不到合约代码，
+// 交易的实际访问超出预测，因此被中止并在下一个区块中执行
+func TestMispredictedAccess(t *testing.T) {
+	c := newCommitter(t.TempDir())
+	defer c.BlockDB.Close()
+	defer c.StateDB.Close()
+
+	code, err := vm.Assemble("PUSH 9\nPUSH 0\nSSTORE \"x\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment := &common.TxDefMsg{IdxFrom: 0, Tx: &common.Transaction{Type: common.TxDeploy, Code: code, GasLimit: common.DefaultGasLimit}}
+	address := vm.ContractAddress(common.NewWord(0), 0, calTxHash(0, deployment))
+	invoke := &common.TxDefMsg{IdxFrom: 1, Tx: &common.Transaction{Type: common.TxInvoke, To: address, GasLimit: common.DefaultGasLimit}}
+	batch := []*common.TxDefMsg{deployment, invoke}
+	aborted, err := c.CommitBlock(context.Background(), common.CommitMsg{Batch: batch, Height: 1})
+	if err != nil || len(aborted) != 1 || aborted[0] != invoke {
+		t.Fatalf("aborted %v (%v), want the invocation", aborted, err)
+	}
+	if _, ok := dumpState(t, c)[statePrefix+vm.StorageKey(address, []byte("x"), 0)]; ok {
+		t.Fatal("aborted transaction left state")
+	}
+	if aborted, err := c.CommitBlock(context.Background(), common.CommitMsg{Batch: aborted, Height: 2}); err != nil || len(aborted) != 0 {
+		t.Fatalf("retry aborted again: %v", err)
+	}
+	if got := dumpState(t, c)[statePrefix+vm.StorageKey(address, []byte("x"), 0)]; got != "0000000000000009" {
+		t.Errorf("x = %q after retry", got)
+	}
+}
@@ -0,0 +1,53 @@
+package commit
+
+import (
+	"errors"
+	"neochain/vm"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// statePrefix 是合约状态在 StateDB 中的键前缀
+const statePrefix = "state/"
+
+var errReadOnlyState = errors.New("block snapshot is read-only")
+
+// stateSnapshot 是 StateDB 上的只读 vm.State，区块执行期间所有交易共享它作为基础状态。
+// 区块执行期间持有 commitMutex，StateDB 不会被修改，因此读到的就是上一个区块提交后的状态。
+type stateSnapshot struct {
+	db *leveldb.DB
+}
+
+var _ vm.State = stateSnapshot{}
+
+func (s stateSnapshot) Get(key string) ([]byte, error) {
+	value, err := s.db.Get([]byte(statePrefix+key), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (s stateSnapshot) Put(key string, value []byte) error {
+	return errReadOnlyState
+}
+
+// blockState 是区块执行期间一组交易共享的只读 vm.State：先查之前各组成功交易合并的写入，
+// 再回落到上一区块的快照。组内的交易并行执行时 writes 不会被修改
+type blockState struct {
+	writes map[string][]byte
+	base   vm.State
+}
+
+var _ vm.State = (*blockState)(nil)
+
+func (s *blockState) Get(key string) ([]byte, error) {
+	if value, ok := s.writes[key]; ok {
+		return value, nil
+	}
+	return s.base.Get(key)
+}
+
+func (s *blockState) Put(key string, value []byte) error {
+	return errReadOnlyState
+}
@@ -0,0 +1,213 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// 字节码格式：
+//
+//	magic "NAC" | version(1B)
+//	uvarint 名字表长度 | 每个名字: uvarint 长度 + 字节
+//	uvarint 指令数     | 每条指令: uvarint 名字下标 + uvarint 参数个数 + 参数...
+//
+// 每个参数以一个类型标记开头，其后为对应的编码，因此解码得到的参数类型与编码前完全一致。
+// 名字表按首次出现的顺序排列，同一段代码总是编码为同样的字节，可以直接用于哈希。
+const BytecodeVersion byte = 1
+
+var bytecodeMagic = []byte("NAC")
+
+// 参数类型标记
+const (
+	argTagUint64 byte = 1 // uint64，uvarint 编码
+	argTagInt    byte = 2 // int，zigzag varint 编码
+	argTagBytes  byte = 3 // []byte，uvarint 长度 + 原始字节
+)
+
+var ErrInvalidBytecode = errors.New("invalid bytecode")
+
+// EncodeCode 将操作码序列编码为二进制字节码
+func EncodeCode(code []Opcode) ([]byte, error) {
+	names := make([]string, 0)
+	nameIdx := make(map[string]uint64)
+	for _, op := range code {
+		if _, ok := nameIdx[op.Name]; !ok {
+			nameIdx[op.Name] = uint64(len(names))
+			names = append(names, op.Name)
+		}
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.Write(bytecodeMagic)
+	buf.WriteByte(BytecodeVersion)
+	writeUvarint(buf, uint64(len(names)))
+	for _, name := range names {
+		writeUvarint(buf, uint64(len(name)))
+		buf.WriteString(name)
+	}
+	writeUvarint(buf, uint64(len(code)))
+	for i, op := range code {
+		writeUvarint(buf, nameIdx[op.Name])
+		writeUvarint(buf, uint64(len(op.Args)))
+		for _, arg := range op.Args {
+			switch v := arg.(type) {
+			case uint64:
+				buf.WriteByte(argTagUint64)
+				writeUvarint(buf, v)
+			case int:
+				buf.WriteByte(argTagInt)
+				writeVarint(buf, int64(v))
+			case []byte:
+				buf.WriteByte(argTagBytes)
+				writeUvarint(buf, uint64(len(v)))
+				buf.Write(v)
+			default:
+				return nil, fmt.Errorf("instruction %d (%s): unsupported operand type %T", i, op.Name, arg)
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeCode 将二进制字节码解码为操作码序列
+func DecodeCode(data []byte) ([]Opcode, error) {
+	r := bytes.NewReader(data)
+	header := make([]byte, len(bytecodeMagic)+1)
+	if _, err := r.Read(header); err != nil || !bytes.Equal(header[:len(bytecodeMagic)], bytecodeMagic) {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidBytecode)
+	}
+	if header[len(bytecodeMagic)] != BytecodeVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidBytecode, header[len(bytecodeMagic)])
+	}
+
+	nNames, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, nNames)
+	for i := range names {
+		name, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		names[i] = string(name)
+	}
+
+	nCode, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	code := make([]Opcode, nCode)
+	for i := range code {
+		idx, err := binary.ReadUvarint(r)
+		if err != nil || idx >= uint64(len(names)) {
+			return nil, fmt.Errorf("%w: instruction %d has bad name index", ErrInvalidBytecode, i)
+		}
+		code[i].Name = names[idx]
+		nArgs, err := readLength(r)
+		if err != nil {
+			return nil, err
+		}
+		if nArgs == 0 {
+			continue
+		}
+		code[i].Args = make([]interface{}, nArgs)
+		for j := range code[i].Args {
+			tag, err := r.ReadByte()
+			if err != nil {
+				return nil, fmt.Errorf("%w: truncated operand", ErrInvalidBytecode)
+			}
+			switch tag {
+			case argTagUint64:
+				v, err := binary.ReadUvarint(r)
+				if err != nil {
+					return nil, fmt.Errorf("%w: truncated operand", ErrInvalidBytecode)
+				}
+				code[i].Args[j] = v
+			case argTagInt:
+				v, err := binary.ReadVarint(r)
+				if err != nil {
+					return nil, fmt.Errorf("%w: truncated operand", ErrInvalidBytecode)
+				}
+				code[i].Args[j] = int(v)
+			case argTagBytes:
+				v, err := readBytes(r)
+				if err != nil {
+					return nil, err
+				}
+				code[i].Args[j] = v
+			default:
+				return nil, fmt.Errorf("%w: instruction %d has unknown operand tag %d", ErrInvalidBytecode, i, tag)
+			}
+		}
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrInvalidBytecode, r.Len())
+	}
+	return code, nil
+}
+
+// MarshalJSON 将 Code 以二进制字节码（base64）的形式编码，避免参数在 JSON 中丢失类型
+func (t Transaction) MarshalJSON() ([]byte, error) {
+	type plain Transaction
+	code, err := EncodeCode(t.Code)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		plain
+		Code []byte `json:"code"`
+	}{plain(t), code})
+}
+
+// UnmarshalJSON 是 MarshalJSON 的逆过程
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	type plain Transaction
+	aux := struct {
+		*plain
+		Code []byte `json:"code"`
+	}{plain: (*plain)(t)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	code, err := DecodeCode(aux.Code)
+	if err != nil {
+		return err
+	}
+	t.Code = code
+	return nil
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	buf.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+}
+
+func writeVarint(buf *bytes.Buffer, v int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	buf.Write(tmp[:binary.PutVarint(tmp[:], v)])
+}
+
+// readLength 读取一个长度字段，长度不会超过剩余字节数，防止恶意输入导致超大分配
+func readLength(r *bytes.Reader) (int, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return 0, fmt.Errorf("%w: bad length", ErrInvalidBytecode)
+	}
+	return int(n), nil
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	if _, err := r.Read(b); err != nil && n > 0 {
+		return nil, fmt.Errorf("%w: truncated bytes", ErrInvalidBytecode)
+	}
+	return b, nil
+}
@@ -1,5 +1,11 @@
 package common
 
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
 // Opcode 表示一个操作码和其参数
 type Opcode struct {
 	Name string
@@ -7,48 +13,120 @@ type Opcode struct {
 }
 
 type TxDefMsg struct {
-	IdxFrom int `json:"idxFrom"`
-	IdxTo   int `json:"idxTo"`
+	IdxFrom int          `json:"idxFrom"`
+	IdxTo   int          `json:"idxTo"`
+	Tx      *Transaction `json:"tx,omitempty"`   // 非空时执行该交易，而不是由 IdxFrom/IdxTo 生成的交易
+	Work    uint64       `json:"work,omitempty"` // 生成的交易中每条 WORK 的迭代次数，为 0 时使用 DefaultWork
 }
 
+// DefaultGasLimit 是 NewTransaction 创建的交易默认的 gas 上限
+const DefaultGasLimit uint64 = 100000
+
+// MaxGasLimit 是单个交易允许声明的最大 gas 上限。
+// gas 是执行量唯一确定性的上界，准入检查拒绝超过它的交易，进入区块的也作为失败交易记录，
+// 因此任何交易在任何节点上的执行时间都有界
+const MaxGasLimit uint64 = 10 * DefaultGasLimit
+
+// ErrGasLimitTooHigh 在交易的 gas 上限超过 MaxGasLimit 时由 CheckGasLimit 返回
+var ErrGasLimitTooHigh = errors.New("gas limit exceeds MaxGasLimit")
+
+// DefaultWork 是 NewTransaction 创建的交易中每条 WORK 指令的迭代次数
+const DefaultWork uint64 = 300000
+
+// TxType 表示交易的类型
+type TxType int
+
+const (
+	TxExec   TxType = iota // 直接执行交易自带的代码
+	TxDeploy               // 将 Code 部署为合约
+	TxInvoke               // 调用地址为 To 的已部署合约
+)
+
 // Transaction 表示一个交易，包含一系列操作码
 type Transaction struct {
-	Code      []Opcode `json:"code"`
+	Type      TxType   `json:"type"`
+	To        string   `json:"to,omitempty"` // TxInvoke 调用的合约地址
+	Code      []Opcode `json:"code"`         // TxExec 执行的代码，或 TxDeploy 部署的代码
 	RWSetHash string   `json:"rwSetHash"`
+	GasLimit  uint64   `json:"gasLimit"`       // 执行该交易最多可消耗的 gas
+	Data      []byte   `json:"data,omitempty"` // 调用数据，可通过 CALLDATALOAD/CALLDATASIZE/CALLDATACOPY 读取
+}
+
+// CheckGasLimit 检查交易的 gas 上限不超过 MaxGasLimit
+func (t *Transaction) CheckGasLimit() error {
+	if t.GasLimit > MaxGasLimit {
+		return fmt.Errorf("%w: %d > %d", ErrGasLimitTooHigh, t.GasLimit, MaxGasLimit)
+	}
+	return nil
 }
 
-// NewTransaction 创建并初始化一个新的交易
+// NewTransaction 创建并初始化一个新的交易，每条 WORK 指令执行 DefaultWork 次迭代
 func NewTransaction(idxFrom int, idxTo int) *Transaction {
-	offsetFrom, offsetTo := idxFrom*8, idxTo*8
+	return NewWorkTransaction(idxFrom, idxTo, DefaultWork)
+}
+
+// NewWorkTransaction 与 NewTransaction 相同，但每条 WORK 指令执行 work 次迭代，
+// 用于调节每个交易的计算量。
+// idxFrom 与 idxTo 不写进程序，而是依次编码在调用数据的两个 32 字节槽位中，
+// 因此 work 相同的交易共享同一段代码
+func NewWorkTransaction(idxFrom int, idxTo int, work uint64) *Transaction {
 	return &Transaction{
 		Code: []Opcode{
-			{"LOAD", []interface{}{uint64(offsetFrom), uint64(8)}}, // 加载内存偏移量0处的8字节数据到堆栈
-			{"DUP", nil},                         // 复制堆栈顶部元素
-			{"PUSH", []interface{}{uint64(128)}}, // 将100推入堆栈
-			{"CMP", nil},                         // 比较堆栈顶部两个元素
-			{"SLEEP", nil},
-			{"JEQ", []interface{}{9, uint64(0)}}, // 如果val<=100,跳转到第7条指令
-			{"PUSH", []interface{}{uint64(2)}},   // 将2推入堆栈
-			{"DIV", nil},                         // 将堆栈顶部元素除以2
-			{"SLEEP", nil},
-			{"JMP", []interface{}{uint64(11)}},  // 跳转到第9条指令
-			{"PUSH", []interface{}{uint64(32)}}, // 将20推入堆栈
-			{"ADD", nil},                        // 将堆栈顶部两个元素相加
-			{"SLEEP", nil},
-			{"STORE", []interface{}{uint64(offsetTo)}}, // 将结果存储回内存偏移量0处
+			{"PUSH", []interface{}{uint64(0)}},        // 0: 调用数据中 idxFrom 的偏移量
+			{"CALLDATALOAD", nil},                     // 1: 读取 idxFrom
+			{"SLOAD", []interface{}{[]byte("slot")}},  // 2: 读取状态 slot[idxFrom]
+			{"DUP", nil},                              // 3: 复制堆栈顶部元素
+			{"PUSH", []interface{}{uint64(128)}},      // 4: 将128推入堆栈
+			{"CMP", nil},                              // 5: 比较堆栈顶部两个元素，val>128 时为1
+			{"WORK", []interface{}{work}},             // 6: 模拟计算
+			{"JEQ", []interface{}{12, uint64(0)}},     // 7: 如果val<=128,跳转到第12条指令
+			{"PUSH", []interface{}{uint64(2)}},        // 8: 将2推入堆栈
+			{"DIV", nil},                              // 9: 将堆栈顶部元素除以2
+			{"WORK", []interface{}{work}},             // 10
+			{"JMP", []interface{}{14}},                // 11: 跳转到第14条指令
+			{"PUSH", []interface{}{uint64(32)}},       // 12: 将32推入堆栈
+			{"ADD", nil},                              // 13: 将堆栈顶部两个元素相加
+			{"WORK", []interface{}{work}},             // 14
+			{"PUSH", []interface{}{uint64(32)}},       // 15: 调用数据中 idxTo 的偏移量
+			{"CALLDATALOAD", nil},                     // 16: 读取 idxTo
+			{"SSTORE", []interface{}{[]byte("slot")}}, // 17: 将结果写入状态 slot[idxTo]
 		},
+		GasLimit: WorkGasLimit(work),
+		Data:     uintSlots(uint64(idxFrom), uint64(idxTo)),
 	}
 }
 
+// workPerGas 与 vm.WorkPerGas 相同：WORK 每消耗 1 gas 执行的迭代次数
+const workPerGas = 64
+
+// WorkGasLimit 返回 NewWorkTransaction 生成的交易的 gas 上限：DefaultGasLimit 加上
+// 最长路径上三条 WORK 的迭代费用，因此 work 再大交易也不会因 gas 不足而失败，
+// 但结果超过 MaxGasLimit 的交易会在准入时被拒绝
+func WorkGasLimit(work uint64) uint64 {
+	return DefaultGasLimit + 3*(work/workPerGas+1)
+}
+
+// uintSlots 将每个值编码为一个 32 字节的大端序槽位，与 CALLDATALOAD 的读取方式一致
+func uintSlots(values ...uint64) []byte {
+	data := make([]byte, 32*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint64(data[32*i+24:32*i+32], v)
+	}
+	return data
+}
+
 type Block struct {
-	Header BlockHeader `json:"header"`
-	Txs    []TxDefMsg  `json:"txs"`
+	Header    BlockHeader `json:"header"`
+	Txs       []TxDefMsg  `json:"txs"`
+	FailedTxs []TxDefMsg  `json:"failedTxs"` // 执行失败或被回滚的交易，不会留下任何状态
 }
 
 type BlockHeader struct {
 	Height        int    `json:"height"`
 	BlockHash     string `json:"blockHash"`
 	PrevBlockHash string `json:"prevBlockHash"`
+	GasUsed       uint64 `json:"gasUsed"`
+	Timestamp     int64  `json:"timestamp"` // 排序层给出的区块时间，Unix 秒
 }
 
 type RWSet struct {
@@ -57,6 +135,34 @@ type RWSet struct {
 }
 
 type CommitMsg struct {
-	Batch  []*TxDefMsg
-	Height int
+	Batch     []*TxDefMsg
+	Height    int
+	Timestamp int64 // 排序层给出的区块时间，Unix 秒，所有节点相同
+}
+
+// Log 是合约通过 LOGn 操作码产生的事件
+type Log struct {
+	Address string `json:"address"` // 产生事件的合约地址，直接执行的代码为空
+	Topics  []Word `json:"topics"`
+	Data    []byte `json:"data"`
+}
+
+// ReceiptStatus 表示交易的执行结果
+type ReceiptStatus int
+
+const (
+	ReceiptFailed  ReceiptStatus = 0 // 执行失败，没有留下任何状态
+	ReceiptSuccess ReceiptStatus = 1
+)
+
+// Receipt 是交易提交之后的执行回执
+type Receipt struct {
+	Height          int           `json:"height"` // 交易所在区块的高度
+	Index           int           `json:"index"`  // 交易在区块批次中的下标
+	TxHash          string        `json:"txHash"` // 交易在批次中的哈希
+	Status          ReceiptStatus `json:"status"`
+	GasUsed         uint64        `json:"gasUsed"`
+	Logs            []Log         `json:"logs"`
+	ContractAddress string        `json:"contractAddress,omitempty"` // 部署交易创建的合约地址
+	Error           string        `json:"error,omitempty"`           // 失败原因
 }
@@ -0,0 +1,97 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Word 是 VM 栈上的一个 256 位无符号整数，按小端顺序保存 4 个 64 位分量，Word[0] 为最低位。
+// 64 位模式下只使用 Word[0]，其余分量恒为 0。
+type Word [4]uint64
+
+// NewWord 返回值为 v 的 Word
+func NewWord(v uint64) Word {
+	return Word{v}
+}
+
+// WordFromBig 返回 b 模 2^256 的值，负数按补码表示
+func WordFromBig(b *big.Int) Word {
+	var w Word
+	v := new(big.Int).Set(b)
+	if v.Sign() < 0 {
+		v.Add(v, new(big.Int).Lsh(big.NewInt(1), 256))
+	}
+	for i, word := range v.Bits() {
+		// big.Word 在 64 位平台上为 64 位
+		if i < 4 {
+			w[i] = uint64(word)
+		}
+	}
+	return w
+}
+
+// Uint64 返回最低的 64 位
+func (w Word) Uint64() uint64 {
+	return w[0]
+}
+
+// IsUint64 判断值是否能用 uint64 表示
+func (w Word) IsUint64() bool {
+	return w[1] == 0 && w[2] == 0 && w[3] == 0
+}
+
+// IsZero 判断值是否为 0
+func (w Word) IsZero() bool {
+	return w == Word{}
+}
+
+// Big 返回与 w 相等的无符号大整数
+func (w Word) Big() *big.Int {
+	b := new(big.Int)
+	for i := 3; i >= 0; i-- {
+		b.Lsh(b, 64)
+		b.Or(b, new(big.Int).SetUint64(w[i]))
+	}
+	return b
+}
+
+// String 返回十进制表示
+func (w Word) String() string {
+	if w.IsUint64() {
+		return fmt.Sprint(w[0])
+	}
+	return w.Big().String()
+}
+
+// Hex 返回 0x 开头、不含前导零的十六进制表示
+func (w Word) Hex() string {
+	return "0x" + w.Big().Text(16)
+}
+
+// MarshalJSON 能用 uint64 表示的值编码为 JSON 数字，否则编码为十六进制字符串
+func (w Word) MarshalJSON() ([]byte, error) {
+	if w.IsUint64() {
+		return json.Marshal(w[0])
+	}
+	return json.Marshal(w.Hex())
+}
+
+func (w *Word) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var v uint64
+		if err := json.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("word must be a number or a hex string: %s", data)
+		}
+		*w = NewWord(v)
+		return nil
+	}
+	b, ok := new(big.Int).SetString(strings.TrimPrefix(s, "0x"), 16)
+	if !ok || b.BitLen() > 256 {
+		return fmt.Errorf("invalid word %q", s)
+	}
+	*w = WordFromBig(b)
+	return nil
+}
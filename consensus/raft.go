@@ -10,6 +10,7 @@ import (
 	"neochain/commit"
 	"neochain/common"
 	"neochain/utils"
+	"neochain/vm"
 	"strings"
 	"sync"
 	"time"
@@ -17,6 +18,8 @@ import (
 	pb "github.com/Jille/raft-grpc-example/proto"
 	"github.com/Jille/raft-grpc-leader-rpc/rafterrors"
 	"github.com/hashicorp/raft"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const BLOCK_SIZE = 128
@@ -27,17 +30,23 @@ type Raft struct {
 	queue    []*common.TxDefMsg
 	epoch    int
 	commiter *commit.Committer
+	ctx      context.Context // 提交区块时使用，被取消后不再提交新的区块
+
+	// timestamp 是最近一条日志被 leader 追加的时间（raft.Log.AppendedAt），Unix 秒。
+	// 它随日志复制到所有节点，因此可以作为区块时间，而不依赖各节点本地的时钟
+	timestamp int64
 
 	refreshTime time.Time
 }
 
 var _ raft.FSM = &Raft{}
 
-func NewRaftEngine(commiter *commit.Committer) *Raft {
+func NewRaftEngine(ctx context.Context, commiter *commit.Committer) *Raft {
 	return &Raft{
 		queue:    make([]*common.TxDefMsg, 0),
 		epoch:    1,
 		commiter: commiter,
+		ctx:      ctx,
 	}
 }
 
@@ -52,47 +61,58 @@ func (f *Raft) Apply(l *raft.Log) interface{} {
 	}
 	log.Printf("Receive a msg: %v, len(queue)=%d, epoch=%d", msg, len(f.queue), f.epoch)
 
-	return f.doApply(msg)
+	return f.doApply(msg, l.AppendedAt)
 }
 
-func (f *Raft) doApply(msg *common.TxDefMsg) interface{} {
+// doApply 将交易加入队列，appendedAt 为其日志被追加的时间
+func (f *Raft) doApply(msg *common.TxDefMsg, appendedAt time.Time) interface{} {
 	f.mtx.Lock()
 	defer f.mtx.Unlock()
 
+	f.timestamp = appendedAt.Unix()
+
 	f.queue = append(f.queue, msg)
 	if len(f.queue) == 1 {
 		consensusComplete := time.Now()
 		log.Printf("performance statistic: consensus[s][%d]: %v", f.epoch, consensusComplete.UnixNano())
 	}
 	for len(f.queue) >= f.epoch*BLOCK_SIZE {
-		f.wrapBlock()
+		if err := f.wrapBlock(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (f *Raft) wrapBlock() {
+// wrapBlock 打包并提交当前区块，调用方持有 f.mtx。
+// 区块在 Apply 中同步提交，中止的交易按 CommitBlock 返回的顺序追加到队尾：
+// 每个节点按相同的日志顺序执行 Apply，因此重新排队的位置在所有节点上都相同。
+// 提交失败时（f.ctx 被取消）返回错误，epoch 不变，下一次 Apply 会重新提交这个区块
+func (f *Raft) wrapBlock() error {
 	consensusComplete := time.Now()
 	log.Printf("performance statistic: consensus[e][%d]: %v", f.epoch, consensusComplete.UnixNano())
 
 	f.refreshTime = time.Now()
 	indexFrom := (f.epoch - 1) * BLOCK_SIZE
 	if indexFrom == int(math.Min(float64(indexFrom+BLOCK_SIZE), float64(len(f.queue)))) {
-		return
+		return nil
 	}
-	go func(localEpoch int) {
-		abortedTxs := f.commiter.CommitBlock(common.CommitMsg{
-			Batch:  f.queue[indexFrom:int(math.Min(float64(indexFrom+BLOCK_SIZE), float64(len(f.queue))))],
-			Height: localEpoch,
-		})
-		for _, abortedTx := range abortedTxs {
-			f.doApply(abortedTx)
-		}
-	}(f.epoch)
+	abortedTxs, err := f.commiter.CommitBlock(f.ctx, common.CommitMsg{
+		Batch:     f.queue[indexFrom:int(math.Min(float64(indexFrom+BLOCK_SIZE), float64(len(f.queue))))],
+		Height:    f.epoch,
+		Timestamp: f.timestamp,
+	})
+	if err != nil {
+		log.Printf("failed to commit block[%d]: %v", f.epoch, err)
+		return err
+	}
+	f.queue = append(f.queue, abortedTxs...)
 
 	f.epoch++
 	consensusStart := time.Now()
 	log.Printf("performance statistic: consensus[s][%d]: %v", f.epoch, consensusStart.UnixNano())
 	f.refreshTime = consensusStart
+	return nil
 }
 
 func (f *Raft) Snapshot() (raft.FSMSnapshot, error) {
@@ -160,6 +180,19 @@ func (r RpcInterface) AddWord(ctx context.Context, req *pb.AddWordRequest) (*pb.
 
 	//time.Sleep(time.Millisecond * time.Duration(300*rand.Float32())) // consensus is too fast
 
+	// 准入检查：gas 上限过高或校验不通过的交易不会进入共识，更不会进入区块
+	msg, err := utils.JsonToTxDefMsg(req.GetWord())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "TxDefMsg deserialization err: %v", err)
+	}
+	tx := utils.TxDefMsgToTransaction(msg)
+	if err := tx.CheckGasLimit(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "transaction rejected: %v", err)
+	}
+	if err := vm.Verify(tx.Code); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "transaction rejected: %v", err)
+	}
+
 	f := r.Raft.Apply([]byte(req.GetWord()), time.Second)
 	if err := f.Error(); err != nil {
 		return nil, rafterrors.MarkRetriable(err)
@@ -6,6 +6,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
@@ -20,7 +21,17 @@ import (
 	_ "google.golang.org/grpc/health"
 )
 
+var (
+	work       = flag.Uint64("work", common.DefaultWork, "WORK iterations per instruction in each transaction")
+	workSpread = flag.Uint64("work-spread", 0, "add a random number of extra iterations in [0, work-spread) to each transaction")
+	seed       = flag.Int64("seed", 1, "seed for the generated transactions")
+)
+
 func main() {
+	flag.Parse()
+	if limit := common.WorkGasLimit(*work + *workSpread); limit > common.MaxGasLimit {
+		log.Fatalf("-work %d with -work-spread %d needs a gas limit of %d, above common.MaxGasLimit %d", *work, *workSpread, limit, common.MaxGasLimit)
+	}
 	serviceConfig := `{"healthCheckConfig": {"serviceName": "Example"}, "loadBalancingConfig": [ { "round_robin": {} } ]}`
 	retryOpts := []grpc_retry.CallOption{
 		grpc_retry.WithBackoff(grpc_retry.BackoffExponential(100 * time.Millisecond)),
@@ -59,13 +70,19 @@ func main() {
 	fmt.Println(resp)
 }
 
+// generateWords 生成交易，相同的参数总是生成相同的交易序列
 func generateWords() <-chan string {
 	ch := make(chan string, 1)
+	rnd := rand.New(rand.NewSource(*seed))
 	go func() {
 		for i := 1; 8192 > i; i++ {
 			idxRange := common.TxDefMsg{
-				IdxFrom: rand.Intn(3),
-				IdxTo:   rand.Intn(3),
+				IdxFrom: rnd.Intn(3),
+				IdxTo:   rnd.Intn(3),
+				Work:    *work,
+			}
+			if *workSpread > 0 {
+				idxRange.Work += uint64(rnd.Int63n(int64(*workSpread)))
 			}
 
 			// 将对象编码为JSON
@@ -0,0 +1,205 @@
+// Package lang 实现一个编译到 VM 操作码的小型合约语言。
+//
+// 程序由顶层声明与语句组成，例如：
+//
+//	// 从 balance[FROM] 向 balance[TO] 转账 AMOUNT
+//	const FROM = 0;
+//	const TO = 1;
+//	const AMOUNT = 10;
+//	var balance;
+//
+//	assert balance[FROM] >= AMOUNT;
+//	balance[FROM] = balance[FROM] - AMOUNT;
+//	balance[TO] = balance[TO] + AMOUNT;
+//
+// 变量是合约的持久化状态：var x 声明状态变量 x，x[i] 读写 SLOAD/SSTORE 中名为 "x" 的第 i 个槽位，
+// 不带下标的 x 等同于 x[0]。const 声明数字常量，var 与 const 只能出现在顶层。
+//
+// 语句有赋值、if/else、while 与 assert，assert 的条件为 0 时交易以 REVERT 失败。
+// 表达式中的数都是无符号的栈元素，支持 + - * / %、比较运算 == != < <= > >=、
+// 短路求值的 && || 以及一元的 ! 与 -；比较与逻辑运算的结果为 0 或 1，算术按 VM 的位宽回绕。
+package lang
+
+import (
+	"fmt"
+	"neochain/common"
+	"neochain/vm"
+	"strings"
+)
+
+// Compile 将源码编译为操作码序列，结果已通过 vm.Verify 校验
+func Compile(src string) ([]common.Opcode, error) {
+	asm, err := CompileAsm(src)
+	if err != nil {
+		return nil, err
+	}
+	code, err := vm.Assemble(asm)
+	if err != nil {
+		return nil, fmt.Errorf("assembling generated code: %v", err)
+	}
+	if err := vm.Verify(code); err != nil {
+		return nil, fmt.Errorf("verifying generated code: %v", err)
+	}
+	return code, nil
+}
+
+// CompileAsm 将源码编译为 vm.Assemble 可以接受的汇编源码
+func CompileAsm(src string) (string, error) {
+	stmts, err := parse(src)
+	if err != nil {
+		return "", err
+	}
+	c := &compiler{}
+	c.stmts(stmts)
+	if c.usesAssert {
+		c.emit("JMP end")
+		c.label("fail")
+		c.emit("REVERT")
+		c.label("end")
+	}
+	return c.sb.String(), nil
+}
+
+// compiler 生成汇编源码。每条语句执行前后栈深度不变，每个表达式求值后在栈上多留一个元素；
+// 条件跳转都使用 JEQ，因此生成的程序只含静态跳转，可以被 vm.Verify 完整检查
+type compiler struct {
+	sb         strings.Builder
+	labels     int
+	usesAssert bool // 是否需要生成 assert 失败时跳转的 fail 标签
+}
+
+func (c *compiler) newLabel() string {
+	c.labels++
+	return fmt.Sprintf("L%d", c.labels-1)
+}
+
+func (c *compiler) label(name string) {
+	c.sb.WriteString(name)
+	c.sb.WriteString(":\n")
+}
+
+func (c *compiler) emit(format string, args ...interface{}) {
+	c.sb.WriteString("\t")
+	fmt.Fprintf(&c.sb, format, args...)
+	c.sb.WriteString("\n")
+}
+
+func (c *compiler) stmts(stmts []stmt) {
+	for _, s := range stmts {
+		c.stmt(s)
+	}
+}
+
+func (c *compiler) stmt(s stmt) {
+	fmt.Fprintf(&c.sb, "\t; line %d\n", s.position().Line)
+	switch s := s.(type) {
+	case *assignStmt:
+		// SSTORE 先弹出槽位，再弹出值
+		c.expr(s.value)
+		c.slot(s.index)
+		c.emit("SSTORE %q", s.name)
+	case *ifStmt:
+		els, end := c.newLabel(), c.newLabel()
+		c.expr(s.cond)
+		c.emit("JEQ %s, 0", els)
+		c.emit("POP")
+		c.stmts(s.then)
+		c.emit("JMP %s", end)
+		c.label(els)
+		c.emit("POP")
+		c.stmts(s.els)
+		c.label(end)
+	case *whileStmt:
+		top, exit := c.newLabel(), c.newLabel()
+		c.label(top)
+		c.expr(s.cond)
+		c.emit("JEQ %s, 0", exit)
+		c.emit("POP")
+		c.stmts(s.body)
+		c.emit("JMP %s", top)
+		c.label(exit)
+		c.emit("POP")
+	case *assertStmt:
+		c.usesAssert = true
+		c.expr(s.cond)
+		c.emit("JEQ fail, 0")
+		c.emit("POP")
+	}
+}
+
+// slot 压入变量的槽位，没有下标时为 0
+func (c *compiler) slot(index expr) {
+	if index == nil {
+		c.emit("PUSH 0")
+		return
+	}
+	c.expr(index)
+}
+
+// binaryOps 是可以直接映射到操作码序列的二元运算符，操作码计算 次栈顶 op 栈顶，即 x op y
+var binaryOps = map[string][]string{
+	"+":  {"ADD"},
+	"-":  {"SUB"},
+	"*":  {"MUL"},
+	"/":  {"DIV"},
+	"%":  {"MOD"},
+	"==": {"EQ"},
+	"!=": {"EQ", "ISZERO"},
+	"<":  {"LT"},
+	">":  {"GT"},
+	"<=": {"GT", "ISZERO"},
+	">=": {"LT", "ISZERO"},
+}
+
+func (c *compiler) expr(e expr) {
+	switch e := e.(type) {
+	case *numberExpr:
+		c.emit("PUSH %d", e.value)
+	case *varExpr:
+		c.slot(e.index)
+		c.emit("SLOAD %q", e.name)
+	case *unaryExpr:
+		if e.op == "-" {
+			c.emit("PUSH 0")
+			c.expr(e.x)
+			c.emit("SUB")
+			return
+		}
+		c.expr(e.x)
+		c.emit("ISZERO")
+	case *binaryExpr:
+		switch e.op {
+		case "&&":
+			// x 为 0 时结果就是栈上的 0，不再对 y 求值
+			end := c.newLabel()
+			c.expr(e.x)
+			c.emit("JEQ %s, 0", end)
+			c.emit("POP")
+			c.expr(e.y)
+			c.emit("ISZERO")
+			c.emit("ISZERO")
+			c.label(end)
+		case "||":
+			// x 不为 0 时结果为 1，不再对 y 求值
+			short, end := c.newLabel(), c.newLabel()
+			c.expr(e.x)
+			c.emit("ISZERO")
+			c.emit("JEQ %s, 0", short)
+			c.emit("POP")
+			c.expr(e.y)
+			c.emit("ISZERO")
+			c.emit("ISZERO")
+			c.emit("JMP %s", end)
+			c.label(short)
+			c.emit("POP")
+			c.emit("PUSH 1")
+			c.label(end)
+		default:
+			c.expr(e.x)
+			c.expr(e.y)
+			for _, op := range binaryOps[e.op] {
+				c.emit(op)
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package lang
+
+import (
+	"errors"
+	"flag"
+	"neochain/common"
+	"neochain/utils"
+	"neochain/vm"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestGolden 将 testdata 中每个 .nc 程序编译为汇编，与同名的 .golden 文件比较。
+// 修改代码生成后用 go test ./lang -update 重新生成
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.nc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test programs")
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		asm, err := CompileAsm(string(src))
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		golden := strings.TrimSuffix(file, ".nc") + ".golden"
+		if *update {
+			if err := os.WriteFile(golden, []byte(asm), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if asm != string(want) {
+			t.Errorf("%s: output differs from %s:\n%s", file, golden, asm)
+		}
+	}
+}
+
+// run 编译并执行 testdata 中的程序，返回状态与执行错误
+func run(t *testing.T, name string, initial map[string]uint64) (vm.State, error) {
+	t.Helper()
+	src, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := Compile(string(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := vm.NewMemState()
+	for key, value := range initial {
+		_ = state.Put(key, utils.UintToBytes(value))
+	}
+	engine := vm.NewVMWithState(state)
+	_, err = engine.ExecuteTransaction(&common.Transaction{Code: code, GasLimit: common.DefaultGasLimit})
+	return state, err
+}
+
+func get(t *testing.T, state vm.State, name string, slot uint64) uint64 {
+	t.Helper()
+	value, err := state.Get(vm.StorageKey("", []byte(name), slot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return utils.BytesToInt(value)
+}
+
+func TestExecute(t *testing.T) {
+	state, err := run(t, "transfer.nc", map[string]uint64{"balance[0]": 25, "balance[1]": 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from, to := get(t, state, "balance", 0), get(t, state, "balance", 1); from != 15 || to != 15 {
+		t.Errorf("transfer: balances %d, %d", from, to)
+	}
+	if _, err := run(t, "transfer.nc", map[string]uint64{"balance[0]": 9}); !errors.Is(err, vm.ErrExecutionReverted) {
+		t.Errorf("overdraft: got %v, want revert", err)
+	}
+
+	for initial, want := range map[uint64]uint64{0: 32, 100: 132, 128: 160, 300: 150} {
+		state, err := run(t, "slot.nc", map[string]uint64{"slot[1]": initial})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := get(t, state, "slot", 2); got != want {
+			t.Errorf("slot[1] = %d: got %d, want %d", initial, got, want)
+		}
+	}
+
+	state, err = run(t, "loop.nc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum, fact := get(t, state, "sum", 0), get(t, state, "fact", 0); sum != 55 || fact != 3628800 {
+		t.Errorf("loop: sum %d, fact %d", sum, fact)
+	}
+
+	state, err = run(t, "logic.nc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grade := get(t, state, "grade", 0); grade != 2 {
+		t.Errorf("logic: grade %d, want 2", grade)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"x = 1;", "1:1: undeclared variable x"},
+		{"var x;\nx = y;", "2:5: undeclared variable y"},
+		{"var x, x;", "1:8: x redeclared"},
+		{"const N = 1;\nN = 2;", "2:1: cannot assign to constant N"},
+		{"const N = x;", "1:11: constant N must be a number"},
+		{"var x;\nif x { var y; }", "2:8: var declarations are only allowed at the top level"},
+		{"var x;\nx = 1", "2:6: expected \";\", found end of file"},
+		{"var x;\nx = 1 +;", "2:8: expected expression"},
+		{"var x;\nwhile x { x = 0;", "2:17: expected \"}\""},
+		{"var x;\nx = 18446744073709551616;", "2:5: invalid number"},
+		{"var x;\nx = 1 @ 2;", "2:7: unexpected character '@'"},
+	}
+	for _, c := range cases {
+		_, err := Compile(c.src)
+		var cerr *Error
+		if !errors.As(err, &cerr) || !strings.HasPrefix(err.Error(), c.want) {
+			t.Errorf("%q: got %v, want %s", c.src, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package lang
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// tokenKind 是词法单元的种类
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokKeyword
+	tokPunct
+)
+
+// token 是一个词法单元，Pos 为它在源码中的起始位置
+type token struct {
+	kind  tokenKind
+	text  string
+	value uint64 // tokNumber 的值
+	pos   Pos
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of file"
+	}
+	return strconv.Quote(t.text)
+}
+
+var keywords = map[string]bool{
+	"var":    true,
+	"const":  true,
+	"if":     true,
+	"else":   true,
+	"while":  true,
+	"assert": true,
+}
+
+// punctuations 按长度从长到短排列，保证先匹配双字符的运算符
+var punctuations = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"{", "}", "(", ")", "[", "]", ";", ",", "=", "<", ">", "+", "-", "*", "/", "%", "!",
+}
+
+// lex 将源码切分为词法单元，以 tokEOF 结尾
+func lex(src string) ([]token, error) {
+	tokens := make([]token, 0)
+	line, col := 1, 1
+	advance := func(n int) {
+		for i := 0; i < n; i++ {
+			if src[i] == '\n' {
+				line++
+				col = 1
+			} else {
+				col++
+			}
+		}
+		src = src[n:]
+	}
+
+	for len(src) > 0 {
+		ch := src[0]
+		pos := Pos{line, col}
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n':
+			advance(1)
+		case ch == '/' && len(src) > 1 && src[1] == '/':
+			n := 0
+			for n < len(src) && src[n] != '\n' {
+				n++
+			}
+			advance(n)
+		case isLetter(ch):
+			n := 0
+			for n < len(src) && (isLetter(src[n]) || isDigit(src[n])) {
+				n++
+			}
+			kind := tokIdent
+			if keywords[src[:n]] {
+				kind = tokKeyword
+			}
+			tokens = append(tokens, token{kind: kind, text: src[:n], pos: pos})
+			advance(n)
+		case isDigit(ch):
+			n := 0
+			for n < len(src) && (isLetter(src[n]) || isDigit(src[n])) {
+				n++
+			}
+			value, err := strconv.ParseUint(src[:n], 0, 64)
+			if err != nil {
+				return nil, &Error{pos, fmt.Sprintf("invalid number %q: must be a decimal or 0x hexadecimal value below 2^64", src[:n])}
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[:n], value: value, pos: pos})
+			advance(n)
+		default:
+			matched := ""
+			for _, p := range punctuations {
+				if len(src) >= len(p) && src[:len(p)] == p {
+					matched = p
+					break
+				}
+			}
+			if matched == "" {
+				return nil, &Error{pos, fmt.Sprintf("unexpected character %q", ch)}
+			}
+			tokens = append(tokens, token{kind: tokPunct, text: matched, pos: pos})
+			advance(len(matched))
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: Pos{line, col}}), nil
+}
+
+func isLetter(ch byte) bool {
+	return ch == '_' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z')
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
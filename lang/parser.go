@@ -0,0 +1,394 @@
+package lang
+
+import "fmt"
+
+// Pos 是源码中的位置，行与列都从 1 开始
+type Pos struct {
+	Line int
+	Col  int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+// Error 是带有源码位置的编译错误
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// stmt 是语句
+type stmt interface {
+	position() Pos
+}
+
+// assignStmt 是 name = value 或 name[index] = value，没有下标时槽位为 0
+type assignStmt struct {
+	at    Pos
+	name  string
+	index expr
+	value expr
+}
+
+type ifStmt struct {
+	at   Pos
+	cond expr
+	then []stmt
+	els  []stmt // 没有 else 分支时为 nil
+}
+
+type whileStmt struct {
+	at   Pos
+	cond expr
+	body []stmt
+}
+
+type assertStmt struct {
+	at   Pos
+	cond expr
+}
+
+func (s *assignStmt) position() Pos { return s.at }
+func (s *ifStmt) position() Pos     { return s.at }
+func (s *whileStmt) position() Pos  { return s.at }
+func (s *assertStmt) position() Pos { return s.at }
+
+// expr 是表达式，求值后在栈上留下一个元素
+type expr interface{}
+
+type numberExpr struct {
+	value uint64
+}
+
+// varExpr 读取状态变量 name 的第 index 个槽位，没有下标时槽位为 0
+type varExpr struct {
+	name  string
+	index expr
+}
+
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+type binaryExpr struct {
+	op   string
+	x, y expr
+}
+
+// binaryPrecedence 给出二元运算符的优先级，数字越大结合越紧
+var binaryPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3,
+	"+": 4, "-": 4,
+	"*": 5, "/": 5, "%": 5,
+}
+
+// parser 是递归下降的语法分析器，同时检查名字是否已声明
+type parser struct {
+	tokens []token
+	pos    int
+	vars   map[string]bool
+	consts map[string]uint64
+}
+
+// parse 将源码解析为顶层语句列表
+func parse(src string) ([]stmt, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{
+		tokens: tokens,
+		vars:   make(map[string]bool),
+		consts: make(map[string]uint64),
+	}
+	stmts := make([]stmt, 0)
+	for p.peek().kind != tokEOF {
+		switch p.peek().text {
+		case "var":
+			if err := p.parseVar(); err != nil {
+				return nil, err
+			}
+		case "const":
+			if err := p.parseConst(); err != nil {
+				return nil, err
+			}
+		default:
+			s, err := p.parseStmt()
+			if err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, s)
+		}
+	}
+	return stmts, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept 在下一个词法单元为 text 时消耗它并返回 true
+func (p *parser) accept(text string) bool {
+	if tok := p.peek(); (tok.kind == tokPunct || tok.kind == tokKeyword) && tok.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("expected %q, found %v", text, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) expectIdent() (token, error) {
+	tok := p.next()
+	if tok.kind != tokIdent {
+		return tok, &Error{tok.pos, fmt.Sprintf("expected identifier, found %v", tok)}
+	}
+	return tok, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &Error{p.peek().pos, fmt.Sprintf(format, args...)}
+}
+
+// declare 检查名字没有被声明过
+func (p *parser) declare(tok token) error {
+	if _, ok := p.consts[tok.text]; ok || p.vars[tok.text] {
+		return &Error{tok.pos, fmt.Sprintf("%s redeclared", tok.text)}
+	}
+	return nil
+}
+
+// parseVar 解析 var a, b;
+func (p *parser) parseVar() error {
+	p.next()
+	for {
+		tok, err := p.expectIdent()
+		if err != nil {
+			return err
+		}
+		if err := p.declare(tok); err != nil {
+			return err
+		}
+		p.vars[tok.text] = true
+		if !p.accept(",") {
+			break
+		}
+	}
+	return p.expect(";")
+}
+
+// parseConst 解析 const NAME = 数字;
+func (p *parser) parseConst() error {
+	p.next()
+	tok, err := p.expectIdent()
+	if err != nil {
+		return err
+	}
+	if err := p.declare(tok); err != nil {
+		return err
+	}
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	value := p.next()
+	if value.kind != tokNumber {
+		return &Error{value.pos, fmt.Sprintf("constant %s must be a number, found %v", tok.text, value)}
+	}
+	p.consts[tok.text] = value.value
+	return p.expect(";")
+}
+
+func (p *parser) parseBlock() ([]stmt, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	stmts := make([]stmt, 0)
+	for !p.accept("}") {
+		switch tok := p.peek(); {
+		case tok.kind == tokEOF:
+			return nil, p.errorf("expected \"}\", found %v", tok)
+		case tok.text == "var" || tok.text == "const":
+			return nil, p.errorf("%s declarations are only allowed at the top level", tok.text)
+		}
+		s, err := p.parseStmt()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, s)
+	}
+	return stmts, nil
+}
+
+func (p *parser) parseStmt() (stmt, error) {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokKeyword && tok.text == "if":
+		return p.parseIf()
+	case tok.kind == tokKeyword && tok.text == "while":
+		p.next()
+		cond, err := p.parseExpr(1)
+		if err != nil {
+			return nil, err
+		}
+		body, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		return &whileStmt{tok.pos, cond, body}, nil
+	case tok.kind == tokKeyword && tok.text == "assert":
+		p.next()
+		cond, err := p.parseExpr(1)
+		if err != nil {
+			return nil, err
+		}
+		return &assertStmt{tok.pos, cond}, p.expect(";")
+	case tok.kind == tokIdent:
+		return p.parseAssign()
+	}
+	return nil, p.errorf("expected statement, found %v", tok)
+}
+
+// parseIf 解析 if 语句，else if 被解析为只含一个 if 语句的 else 分支
+func (p *parser) parseIf() (stmt, error) {
+	tok := p.next()
+	cond, err := p.parseExpr(1)
+	if err != nil {
+		return nil, err
+	}
+	then, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	s := &ifStmt{at: tok.pos, cond: cond, then: then}
+	if !p.accept("else") {
+		return s, nil
+	}
+	if p.peek().text == "if" {
+		elif, err := p.parseIf()
+		if err != nil {
+			return nil, err
+		}
+		s.els = []stmt{elif}
+		return s, nil
+	}
+	s.els, err = p.parseBlock()
+	return s, err
+}
+
+func (p *parser) parseAssign() (stmt, error) {
+	tok := p.next()
+	if _, ok := p.consts[tok.text]; ok {
+		return nil, &Error{tok.pos, fmt.Sprintf("cannot assign to constant %s", tok.text)}
+	}
+	if !p.vars[tok.text] {
+		return nil, &Error{tok.pos, fmt.Sprintf("undeclared variable %s", tok.text)}
+	}
+	s := &assignStmt{at: tok.pos, name: tok.text}
+	if p.accept("[") {
+		index, err := p.parseExpr(1)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		s.index = index
+	}
+	if err := p.expect("="); err != nil {
+		return nil, err
+	}
+	value, err := p.parseExpr(1)
+	if err != nil {
+		return nil, err
+	}
+	s.value = value
+	return s, p.expect(";")
+}
+
+// parseExpr 解析优先级不低于 minPrec 的二元表达式，同一优先级的运算符左结合
+func (p *parser) parseExpr(minPrec int) (expr, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		prec, ok := binaryPrecedence[tok.text]
+		if tok.kind != tokPunct || !ok || prec < minPrec {
+			return x, nil
+		}
+		p.next()
+		y, err := p.parseExpr(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryExpr{tok.text, x, y}
+	}
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if tok := p.peek(); tok.kind == tokPunct && (tok.text == "!" || tok.text == "-") {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{tok.text, x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	tok := p.next()
+	switch {
+	case tok.kind == tokNumber:
+		return &numberExpr{tok.value}, nil
+	case tok.kind == tokPunct && tok.text == "(":
+		x, err := p.parseExpr(1)
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+	case tok.kind == tokIdent:
+		if value, ok := p.consts[tok.text]; ok {
+			return &numberExpr{value}, nil
+		}
+		if !p.vars[tok.text] {
+			return nil, &Error{tok.pos, fmt.Sprintf("undeclared variable %s", tok.text)}
+		}
+		v := &varExpr{name: tok.text}
+		if p.accept("[") {
+			index, err := p.parseExpr(1)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			v.index = index
+		}
+		return v, nil
+	}
+	return nil, &Error{tok.pos, fmt.Sprintf("expected expression, found %v", tok)}
+}
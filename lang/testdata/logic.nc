@@ -0,0 +1,14 @@
+// 短路求值、else if 与一元运算
+var x, y, grade;
+
+x = 7;
+y = 0;
+// y 为 0 时不会求值 x / y
+if y != 0 && x / y > 1 {
+	grade = 1;
+} else if !(x < 5) || x % 2 == 0 {
+	grade = 2;
+} else {
+	grade = 3;
+}
+assert -x + x == 0;
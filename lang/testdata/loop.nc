@@ -0,0 +1,13 @@
+// 计算 1 到 N 的和与 N 的阶乘
+const N = 10;
+var i, sum, fact;
+
+i = 1;
+sum = 0;
+fact = 1;
+while i <= N {
+	sum = sum + i;
+	fact = fact * i;
+	i = i + 1;
+}
+assert sum == 55;
@@ -0,0 +1,12 @@
+// 读取 slot[FROM]，大于 128 时减半，否则加 32，结果写入 slot[TO]
+const FROM = 1;
+const TO = 2;
+var slot, v;
+
+v = slot[FROM];
+if v > 128 {
+	v = v / 2;
+} else {
+	v = v + 32;
+}
+slot[TO] = v;
@@ -0,0 +1,9 @@
+// 从 balance[FROM] 向 balance[TO] 转账，余额不足时交易失败
+const FROM = 0;
+const TO = 1;
+const AMOUNT = 10;
+var balance;
+
+assert balance[FROM] >= AMOUNT;
+balance[FROM] = balance[FROM] - AMOUNT;
+balance[TO] = balance[TO] + AMOUNT;
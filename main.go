@@ -48,7 +48,7 @@ func main() {
 
 	commiter := commit.NewCommitter(*raftId)
 
-	wt := consensus.NewRaftEngine(commiter)
+	wt := consensus.NewRaftEngine(ctx, commiter)
 
 	r, tm, err := NewRaft(ctx, *raftId, *myAddr, wt)
 	if err != nil {
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"encoding/binary"
+	"neochain/common"
 )
 
 func UintToBytes(num uint64) []byte {
@@ -23,3 +24,26 @@ func LongBytesToInt(buf []byte) []uint64 {
 	}
 	return ints
 }
+
+// WordToBytes 将 w 编码为 32 字节的大端序字节数组
+func WordToBytes(w common.Word) []byte {
+	buf := make([]byte, 32)
+	for i := 0; i < 4; i++ {
+		binary.BigEndian.PutUint64(buf[24-8*i:32-8*i], w[i])
+	}
+	return buf
+}
+
+// BytesToWord 将 buf 视为大端序整数转换为 Word，不足 32 字节时高位补零，超过 32 字节时只取最后 32 字节
+func BytesToWord(buf []byte) common.Word {
+	if len(buf) > 32 {
+		buf = buf[len(buf)-32:]
+	}
+	localBuf := make([]byte, 32)
+	copy(localBuf[32-len(buf):], buf)
+	var w common.Word
+	for i := 0; i < 4; i++ {
+		w[i] = binary.BigEndian.Uint64(localBuf[24-8*i : 32-8*i])
+	}
+	return w
+}
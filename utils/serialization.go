@@ -15,6 +15,12 @@ func JsonToTxDefMsg(d string) (*common.TxDefMsg, error) {
 }
 
 func TxDefMsgToTransaction(msg *common.TxDefMsg) *common.Transaction {
+	if msg.Tx != nil {
+		return msg.Tx
+	}
+	if msg.Work != 0 {
+		return common.NewWorkTransaction(msg.IdxFrom, msg.IdxTo, msg.Work)
+	}
 	return common.NewTransaction(msg.IdxFrom, msg.IdxTo)
 }
 
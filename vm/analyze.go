@@ -0,0 +1,466 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"neochain/common"
+	"sort"
+	"strings"
+)
+
+// MaxAnalysisWork 是一次 Analyze 的工作量上限，按处理每条指令时抽象栈的元素个数加 1 累计。
+// 超过上限的交易视为可能访问任何位置，使分析的时间与内存与程序的形状无关地有界
+const MaxAnalysisWork = 1 << 20
+
+// Location 是静态分析预测的一个状态位置。Prefix 为 false 时是一个具体的键；
+// 为 true 时表示所有以 Key 开头的键，用于槽位依赖运行时数据、无法静态确定的 SLOAD/SSTORE
+type Location struct {
+	Key    string
+	Prefix bool
+}
+
+func (l Location) String() string {
+	if l.Prefix {
+		return l.Key + "*"
+	}
+	return l.Key
+}
+
+// Matches 判断状态键 key 是否落在 l 中
+func (l Location) Matches(key string) bool {
+	if l.Prefix {
+		return strings.HasPrefix(key, l.Key)
+	}
+	return key == l.Key
+}
+
+// Overlaps 判断 l 与 o 是否可能包含同一个键
+func (l Location) Overlaps(o Location) bool {
+	switch {
+	case l.Prefix && o.Prefix:
+		return strings.HasPrefix(l.Key, o.Key) || strings.HasPrefix(o.Key, l.Key)
+	case l.Prefix:
+		return strings.HasPrefix(o.Key, l.Key)
+	case o.Prefix:
+		return strings.HasPrefix(l.Key, o.Key)
+	}
+	return l.Key == o.Key
+}
+
+// AccessSet 是静态分析预测的交易状态读写集，是实际读写集的超集
+type AccessSet struct {
+	Reads  []Location // 可能读取的位置，按键排序
+	Writes []Location // 可能写入的位置，按键排序
+	Any    bool       // 无法确定访问范围，可能读写任何键，例如程序中含有扩展操作码
+}
+
+// Conflicts 判断两个交易是否可能冲突：一方可能写入另一方读写的位置
+func (s *AccessSet) Conflicts(o *AccessSet) bool {
+	if s.Any || o.Any {
+		return true
+	}
+	return overlaps(s.Writes, o.Writes) || overlaps(s.Writes, o.Reads) || overlaps(s.Reads, o.Writes)
+}
+
+// Covers 判断实际执行得到的状态读写集是否在预测范围内。
+// 读过的键可以落在 Reads 或 Writes 中，写过的键必须落在 Writes 中
+func (s *AccessSet) Covers(reads, writes []string) bool {
+	if s.Any {
+		return true
+	}
+	for _, key := range reads {
+		if !matchesAny(s.Reads, key) && !matchesAny(s.Writes, key) {
+			return false
+		}
+	}
+	for _, key := range writes {
+		if !matchesAny(s.Writes, key) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *AccessSet) String() string {
+	if s.Any {
+		return "any"
+	}
+	return fmt.Sprintf("reads %v, writes %v", s.Reads, s.Writes)
+}
+
+func overlaps(a, b []Location) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x.Overlaps(y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesAny(locs []Location, key string) bool {
+	for _, l := range locs {
+		if l.Matches(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Analyze 在不执行交易的情况下推断它可能访问的状态位置，结果是实际读写集的超集。
+// 调用数据、区块环境 e.Block 与位宽 e.WordSize 应与执行时相同；
+// 合约代码从 e.State 中读取，交易执行前部署的合约在分析时必须已经存在于 e.State 中；
+// 部署交易的地址按 e.State 中发送方的 nonce 预测。
+//
+// 分析对栈做抽象解释：每个元素要么是已知的常量，要么未知。PUSH、算术、比较、
+// CALLDATALOAD 等操作数全部已知时直接调用处理函数求值，JEQ 与 JUMPI 的条件已知时只沿实际的分支进行。
+// SLOAD/SSTORE 的槽位已知时得到具体的键，未知时（如槽位来自状态或内存）得到该变量所有槽位的前缀。
+// 目标未知的 JUMPI 可能跳到任何指令，此时以未知的栈从每条指令开始分析。
+// 被调用的合约按未知的调用数据与调用方分析，每个地址只分析一次。
+// 程序含有扩展操作码、抽象栈超过 MaxStackDepth（执行时一定栈溢出）或工作量超过 MaxAnalysisWork 时
+// 停止分析，返回 Any 为 true 的结果。
+//
+// 只有交易代码无法解码或读取 e.State 出错时返回错误。
+func (e *VM) Analyze(t *common.Transaction) (*AccessSet, error) {
+	a := &analyzer{
+		vm:      e,
+		reads:   make(map[Location]bool),
+		writes:  make(map[Location]bool),
+		callees: make(map[string]bool),
+		scratch: &Context{
+			Memory:   NewMemory(nil),
+			Stack:    make([]Word, 0, 8),
+			vm:       e,
+			wordSize: e.WordSize,
+			checked:  e.CheckOverflow,
+		},
+	}
+	top := frame{callData: t.Data, dataKnown: true, caller: e.Block.Caller, callerKnown: true}
+	switch t.Type {
+	case common.TxExec:
+		prog, err := Decode(t.Code)
+		if err != nil {
+			return nil, err
+		}
+		if err := a.frame(top, prog); err != nil {
+			return nil, err
+		}
+	case common.TxDeploy:
+		address, _, err := nextAddress(e.State, e.Block.Caller, e.Block.TxHash)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range []Location{{Key: NonceKey(e.Block.Caller)}, {Key: CodeKey(address)}} {
+			a.reads[key] = true
+			a.writes[key] = true
+		}
+	case common.TxInvoke:
+		prog, err := a.contract(t.To)
+		if err != nil {
+			return nil, err
+		}
+		if prog != nil {
+			top.address = t.To
+			if err := a.frame(top, prog); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown transaction type %d", t.Type)
+	}
+	if a.any {
+		return &AccessSet{Any: true}, nil
+	}
+	return &AccessSet{Reads: sortedLocations(a.reads), Writes: sortedLocations(a.writes)}, nil
+}
+
+func sortedLocations(set map[Location]bool) []Location {
+	locs := make([]Location, 0, len(set))
+	for l := range set {
+		locs = append(locs, l)
+	}
+	sort.Slice(locs, func(i, j int) bool {
+		if locs[i].Key != locs[j].Key {
+			return locs[i].Key < locs[j].Key
+		}
+		return !locs[i].Prefix && locs[j].Prefix
+	})
+	return locs
+}
+
+// constOps 是结果只取决于操作数、调用数据与区块环境的操作码，
+// 操作数都已知时分析器直接调用处理函数求值
+var constOps = map[string]bool{
+	"PUSH": true, "PUSHW": true,
+	"ADD": true, "SUB": true, "MUL": true, "DIV": true, "MOD": true, "SDIV": true, "SMOD": true, "EXP": true,
+	"AND": true, "OR": true, "XOR": true, "NOT": true, "SHL": true, "SHR": true, "SAR": true,
+	"CMP": true, "LT": true, "GT": true, "SLT": true, "SGT": true, "EQ": true, "ISZERO": true,
+	"CALLDATALOAD": true, "CALLDATASIZE": true,
+	"HEIGHT": true, "TIMESTAMP": true, "PREVHASH": true, "TXHASH": true, "CALLER": true,
+}
+
+// absValue 是抽象解释中的栈元素，known 为 false 时值未知
+type absValue struct {
+	w     Word
+	known bool
+}
+
+// absStack 是抽象的栈，栈底以下的元素都视为未知
+type absStack []absValue
+
+// pop 弹出栈顶，栈为空时得到未知的元素
+func (s *absStack) pop() absValue {
+	if len(*s) == 0 {
+		return absValue{}
+	}
+	v := (*s)[len(*s)-1]
+	*s = (*s)[:len(*s)-1]
+	return v
+}
+
+// reserve 在栈底补齐未知的元素，使栈中至少有 n 个元素
+func (s *absStack) reserve(n int) {
+	if len(*s) < n {
+		*s = append(make(absStack, n-len(*s)), *s...)
+	}
+}
+
+// join 合并到达同一条指令的两个栈：从栈顶对齐，取较短的深度，值不同的元素变为未知。
+// 返回合并结果以及它是否与 s 不同
+func (s absStack) join(o absStack) (absStack, bool) {
+	n := len(s)
+	if len(o) < n {
+		n = len(o)
+	}
+	joined := make(absStack, n)
+	changed := n < len(s)
+	for i := 0; i < n; i++ {
+		a, b := s[len(s)-n+i], o[len(o)-n+i]
+		if a.known && b.known && a.w == b.w {
+			joined[i] = a
+			continue
+		}
+		changed = changed || a.known
+	}
+	return joined, changed
+}
+
+// frame 描述被分析的一个调用帧
+type frame struct {
+	address     string // 合约地址，直接执行的代码为空
+	callData    []byte
+	dataKnown   bool // 调用数据是否已知，被调用的合约为 false
+	caller      Word
+	callerKnown bool
+}
+
+// analyzer 累积一次 Analyze 中所有调用帧的访问
+type analyzer struct {
+	vm      *VM
+	reads   map[Location]bool
+	writes  map[Location]bool
+	callees map[string]bool // 已经分析过的被调用合约
+	any     bool
+	work    int      // 已经消耗的工作量，见 MaxAnalysisWork
+	scratch *Context // 求值常量操作码时使用的执行环境
+}
+
+// contract 读取合约代码，合约不存在或代码无法解码时 CALL 只会失败，返回 nil, nil
+func (a *analyzer) contract(address string) (*Program, error) {
+	a.reads[Location{Key: CodeKey(address)}] = true
+	prog, err := loadContract(a.vm.State, address)
+	if err == nil {
+		return prog, nil
+	}
+	var verr *VerifyError
+	if errors.Is(err, ErrNoContract) || errors.As(err, &verr) || errors.Is(err, common.ErrInvalidBytecode) {
+		return nil, nil
+	}
+	return nil, err
+}
+
+// location 返回变量 name 在槽位 slot 处的位置
+func (a *analyzer) location(f frame, name []byte, slot absValue) Location {
+	if slot.known {
+		return Location{Key: storageKey(f.address, name, slot.w)}
+	}
+	return Location{Key: storagePrefix(f.address, name), Prefix: true}
+}
+
+// frame 以工作表算法分析一个调用帧，直到每条指令处的抽象栈不再变化
+func (a *analyzer) frame(f frame, prog *Program) error {
+	code := prog.Instructions
+	states := make([]absStack, len(code))
+	reached := make([]bool, len(code))
+	work := make([]int, 0)
+	visit := func(pc int, stack absStack) {
+		if len(stack) > MaxStackDepth {
+			a.any = true
+			return
+		}
+		if pc < 0 || pc >= len(code) {
+			return // 正常结束或执行时跳转出错
+		}
+		if !reached[pc] {
+			reached[pc] = true
+			states[pc] = stack
+			work = append(work, pc)
+			return
+		}
+		if joined, changed := states[pc].join(stack); changed {
+			states[pc] = joined
+			work = append(work, pc)
+		}
+	}
+	dynamic := false
+	visit(0, absStack{})
+	for len(work) > 0 && !a.any {
+		pc := work[len(work)-1]
+		work = work[:len(work)-1]
+		in := &code[pc]
+		op := &operations[in.Op]
+		a.work += len(states[pc]) + 1
+		if op.extension || a.work > MaxAnalysisWork {
+			a.any = true
+			return nil
+		}
+		stack := append(absStack{}, states[pc]...)
+
+		switch op.name {
+		case "JMP":
+			visit(in.Target, stack)
+		case "JEQ":
+			top := stack.pop()
+			stack = append(stack, top)
+			if !top.known || top.w == common.NewWord(in.Uint64[0]) {
+				visit(in.Target, stack)
+			}
+			if !top.known || top.w != common.NewWord(in.Uint64[0]) {
+				visit(pc+1, stack)
+			}
+		case "JUMPI":
+			target, cond := stack.pop(), stack.pop()
+			visit(pc+1, stack)
+			switch {
+			case cond.known && cond.w.IsZero():
+			case target.known:
+				if target.w.IsUint64() && target.w.Uint64() <= math.MaxInt32 {
+					visit(int(target.w.Uint64()), stack)
+				}
+			case !dynamic:
+				// 可能跳到任何指令，到达时栈中的值都未知
+				dynamic = true
+				for i := range code {
+					visit(i, absStack{})
+				}
+			}
+		case "REVERT", "RETURN":
+		case "SLOAD":
+			a.reads[a.location(f, in.Bytes, stack.pop())] = true
+			stack = append(stack, absValue{})
+			visit(pc+1, stack)
+		case "SSTORE":
+			a.writes[a.location(f, in.Bytes, stack.pop())] = true
+			stack.pop()
+			visit(pc+1, stack)
+		case "CALL":
+			stack.pop()
+			stack.pop()
+			stack = append(stack, absValue{})
+			if err := a.call(string(in.Bytes)); err != nil {
+				return err
+			}
+			if a.any {
+				return nil
+			}
+			visit(pc+1, stack)
+		default:
+			a.apply(f, in, op, prog.Code[pc].Args, &stack)
+			visit(pc+1, stack)
+		}
+	}
+	return nil
+}
+
+// call 分析 CALL 调用的合约，预编译合约不访问状态
+func (a *analyzer) call(address string) error {
+	if _, ok := precompiles[address]; ok {
+		return nil
+	}
+	if a.callees[address] {
+		return nil
+	}
+	a.callees[address] = true
+	prog, err := a.contract(address)
+	if err != nil || prog == nil {
+		return err
+	}
+	return a.frame(frame{address: address}, prog)
+}
+
+// apply 计算不访问状态、不改变控制流的指令对抽象栈的效果。
+// 复制与交换指令保留元素是否已知；constOps 中的操作码在操作数都已知时求值；
+// 其余指令的结果都是未知的
+func (a *analyzer) apply(f frame, in *Instruction, op *operation, args []interface{}, stack *absStack) {
+	name := op.name
+	switch {
+	case name == "POP":
+		stack.pop()
+		return
+	case strings.HasPrefix(name, "DUP"):
+		n := op.pops
+		stack.reserve(n)
+		*stack = append(*stack, (*stack)[len(*stack)-n])
+		return
+	case strings.HasPrefix(name, "SWAP"):
+		n := op.pops - 1
+		stack.reserve(n + 1)
+		top := len(*stack) - 1
+		(*stack)[top], (*stack)[top-n] = (*stack)[top-n], (*stack)[top]
+		return
+	}
+
+	pushes := op.stackOut(args)
+	inputs := make([]Word, op.pops)
+	known := constOps[name]
+	if (name == "CALLDATALOAD" || name == "CALLDATASIZE") && !f.dataKnown || name == "CALLER" && !f.callerKnown {
+		known = false
+	}
+	for i := op.pops - 1; i >= 0; i-- {
+		v := stack.pop()
+		inputs[i] = v.w
+		known = known && v.known
+	}
+	if known {
+		if outputs, ok := a.eval(f, in, op, inputs); ok && len(outputs) == pushes {
+			for _, w := range outputs {
+				*stack = append(*stack, absValue{w: w, known: true})
+			}
+			return
+		}
+	}
+	for i := 0; i < pushes; i++ {
+		*stack = append(*stack, absValue{})
+	}
+}
+
+// eval 以 inputs 为栈调用处理函数，返回执行后的栈。处理函数出错或 panic 时 ok 为 false，
+// 对应的执行路径在运行时会失败，结果视为未知即可
+func (a *analyzer) eval(f frame, in *Instruction, op *operation, inputs []Word) (outputs []Word, ok bool) {
+	ctx := a.scratch
+	ctx.Stack = append(ctx.Stack[:0], inputs...)
+	ctx.Gas = math.MaxUint64
+	ctx.CallData = f.callData
+	ctx.Caller = f.caller
+	defer func() {
+		if recover() != nil {
+			outputs, ok = nil, false
+		}
+	}()
+	if err := op.action(ctx, in); err != nil {
+		return nil, false
+	}
+	return append([]Word(nil), ctx.Stack...), true
+}
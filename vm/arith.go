@@ -0,0 +1,226 @@
+package vm
+
+import (
+	"errors"
+	"math/big"
+	"neochain/common"
+)
+
+// ErrDivisionByZero 由 DIV、MOD、SDIV、SMOD 在除数为 0 时返回
+var ErrDivisionByZero = errors.New("division by zero")
+
+// 二元操作码先弹出 a（栈顶），再弹出 b，结果为 b op a，
+// 即 "PUSH x; PUSH y; SUB" 计算 x - y，"PUSH x; PUSH y; LT" 计算 x < y。
+//
+// 无符号算术按 2^位宽 取模回绕；VM 开启 CheckOverflow 时，ADD、SUB、MUL、EXP 与 SDIV
+// 在真实结果超出位宽时返回 ErrArithmeticOverflow。有符号操作码把栈上的值视为当前位宽的补码，
+// 不检查溢出时 SDIV 中 MIN / -1 回绕为 MIN，SMOD 的结果与被除数同号。
+// 移位位数不小于位宽时，SHL、SHR 的结果为 0，SAR 的结果为 0 或全 1。
+// 比较操作码的结果为 1（真）或 0（假）。
+
+func add(ctx *Context, in *Instruction) error {
+	a := ctx.Pop()
+	b := ctx.Pop()
+	return ctx.pushArith(add256(b, a))
+}
+
+func sub(ctx *Context, in *Instruction) error {
+	a := ctx.Pop()
+	b := ctx.Pop()
+	return ctx.pushArith(sub256(b, a))
+}
+
+func mul(ctx *Context, in *Instruction) error {
+	a := ctx.Pop()
+	b := ctx.Pop()
+	return ctx.pushArith(mul256(b, a))
+}
+
+func div(ctx *Context, in *Instruction) error {
+	a := ctx.Pop()
+	b := ctx.Pop()
+	if a.IsZero() {
+		return ErrDivisionByZero
+	}
+	if a.IsUint64() && b.IsUint64() {
+		ctx.Push(Word{b[0] / a[0]})
+		return nil
+	}
+	ctx.Push(common.WordFromBig(new(big.Int).Quo(b.Big(), a.Big())))
+	return nil
+}
+
+func mod(ctx *Context, in *Instruction) error {
+	a := ctx.Pop()
+	b := ctx.Pop()
+	if a.IsZero() {
+		return ErrDivisionByZero
+	}
+	if a.IsUint64() && b.IsUint64() {
+		ctx.Push(Word{b[0] % a[0]})
+		return nil
+	}
+	ctx.Push(common.WordFromBig(new(big.Int).Rem(b.Big(), a.Big())))
+	return nil
+}
+
+func sdiv(ctx *Context, in *Instruction) error {
+	a := ctx.signExtend(ctx.Pop())
+	b := ctx.signExtend(ctx.Pop())
+	if a.IsZero() {
+		return ErrDivisionByZero
+	}
+	return ctx.pushSigned(new(big.Int).Quo(signedBig(b), signedBig(a)))
+}
+
+func smod(ctx *Context, in *Instruction) error {
+	a := ctx.signExtend(ctx.Pop())
+	b := ctx.signExtend(ctx.Pop())
+	if a.IsZero() {
+		return ErrDivisionByZero
+	}
+	return ctx.pushSigned(new(big.Int).Rem(signedBig(b), signedBig(a)))
+}
+
+// exp 计算 b 的 a 次方，按指数的有效字节数收取额外 gas
+func exp(ctx *Context, in *Instruction) error {
+	a := ctx.Pop()
+	b := ctx.Pop()
+	if err := ctx.useDynamicGas(GasExpByte*uint64((bitLen256(a)+7)/8), "EXP"); err != nil {
+		return err
+	}
+	// base 溢出后只要再乘进结果，真实结果就一定溢出
+	result, base := Word{1}, b
+	overflow, baseOverflow := false, false
+	for e := a; !e.IsZero(); e = rsh256(e, 1) {
+		if e[0]&1 == 1 {
+			r, of := mul256(result, base)
+			overflow = overflow || baseOverflow || of || !ctx.fits(r)
+			result = ctx.mask(r)
+		}
+		r, of := mul256(base, base)
+		baseOverflow = baseOverflow || of || !ctx.fits(r)
+		base = ctx.mask(r)
+	}
+	return ctx.pushArith(result, overflow)
+}
+
+func and(ctx *Context, in *Instruction) error {
+	a := ctx.Pop()
+	b := ctx.Pop()
+	ctx.Push(Word{b[0] & a[0], b[1] & a[1], b[2] & a[2], b[3] & a[3]})
+	return nil
+}
+
+func or(ctx *Context, in *Instruction) error {
+	a := ctx.Pop()
+	b := ctx.Pop()
+	ctx.Push(Word{b[0] | a[0], b[1] | a[1], b[2] | a[2], b[3] | a[3]})
+	return nil
+}
+
+func xor(ctx *Context, in *Instruction) error {
+	a := ctx.Pop()
+	b := ctx.Pop()
+	ctx.Push(Word{b[0] ^ a[0], b[1] ^ a[1], b[2] ^ a[2], b[3] ^ a[3]})
+	return nil
+}
+
+func not(ctx *Context, in *Instruction) error {
+	ctx.Push(ctx.mask(not256(ctx.Pop())))
+	return nil
+}
+
+func shl(ctx *Context, in *Instruction) error {
+	shift := shiftAmount(ctx.Pop())
+	value := ctx.Pop()
+	ctx.Push(ctx.mask(lsh256(value, shift)))
+	return nil
+}
+
+func shr(ctx *Context, in *Instruction) error {
+	shift := shiftAmount(ctx.Pop())
+	value := ctx.Pop()
+	ctx.Push(rsh256(value, shift))
+	return nil
+}
+
+func sar(ctx *Context, in *Instruction) error {
+	shift := shiftAmount(ctx.Pop())
+	value := ctx.signExtend(ctx.Pop())
+	if shift > 255 {
+		shift = 255
+	}
+	if isNegative(value) {
+		ctx.Push(ctx.mask(not256(rsh256(not256(value), shift))))
+	} else {
+		ctx.Push(rsh256(value, shift))
+	}
+	return nil
+}
+
+func lt(ctx *Context, in *Instruction) error {
+	a := ctx.Pop()
+	b := ctx.Pop()
+	ctx.Push(boolWord(cmp256(b, a) < 0))
+	return nil
+}
+
+func gt(ctx *Context, in *Instruction) error {
+	a := ctx.Pop()
+	b := ctx.Pop()
+	ctx.Push(boolWord(cmp256(b, a) > 0))
+	return nil
+}
+
+func slt(ctx *Context, in *Instruction) error {
+	a := ctx.signExtend(ctx.Pop())
+	b := ctx.signExtend(ctx.Pop())
+	ctx.Push(boolWord(signedCmp(b, a) < 0))
+	return nil
+}
+
+func sgt(ctx *Context, in *Instruction) error {
+	a := ctx.signExtend(ctx.Pop())
+	b := ctx.signExtend(ctx.Pop())
+	ctx.Push(boolWord(signedCmp(b, a) > 0))
+	return nil
+}
+
+func eq(ctx *Context, in *Instruction) error {
+	a := ctx.Pop()
+	b := ctx.Pop()
+	ctx.Push(boolWord(b == a))
+	return nil
+}
+
+func isZero(ctx *Context, in *Instruction) error {
+	ctx.Push(boolWord(ctx.Pop().IsZero()))
+	return nil
+}
+
+// cmp 压入栈顶元素是否小于其下方的元素
+func cmp(ctx *Context, in *Instruction) error {
+	a := ctx.Pop()
+	b := ctx.Pop()
+	ctx.Push(boolWord(cmp256(a, b) < 0))
+	return nil
+}
+
+// signedCmp 按 256 位补码比较 a 与 b
+func signedCmp(a, b Word) int {
+	if na, nb := isNegative(a), isNegative(b); na != nb {
+		if na {
+			return -1
+		}
+		return 1
+	}
+	return cmp256(a, b)
+}
+
+func boolWord(b bool) Word {
+	if b {
+		return Word{1}
+	}
+	return Word{}
+}
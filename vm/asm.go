@@ -0,0 +1,299 @@
+package vm
+
+import (
+	"encoding/hex"
+	"fmt"
+	"neochain/common"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Assemble 将汇编源码翻译为操作码序列。
+//
+// 源码按行书写，语法如下：
+//
+//	; 注释，# 也可以作为注释
+//	.const LIMIT 128        ; 定义常量，可在任何参数位置使用
+//	loop:                   ; 标签，值为下一条指令的下标
+//	    LOAD 0, 8           ; 参数以空格或逗号分隔
+//	    JEQ loop, LIMIT     ; 跳转目标可以直接写标签
+//	    STOREI 24 0xcafe    ; bytes 参数写作 0x 开头的十六进制或 "字符串"
+//	    PUSH loop           ; uint64 参数也可以写标签，供 JUMPI 使用
+//
+// 操作码不区分大小写，标签与常量区分大小写。
+func Assemble(src string) ([]common.Opcode, error) {
+	type line struct {
+		no     int
+		name   string
+		tokens []string
+	}
+
+	labels := make(map[string]int)
+	consts := make(map[string]string)
+	lines := make([]line, 0)
+
+	// 第一遍：收集标签、常量与指令
+	for i, raw := range strings.Split(src, "\n") {
+		no := i + 1
+		tokens, err := tokenize(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", no, err)
+		}
+		for len(tokens) > 0 && strings.HasSuffix(tokens[0], ":") {
+			label := strings.TrimSuffix(tokens[0], ":")
+			if !isIdent(label) {
+				return nil, fmt.Errorf("line %d: invalid label %q", no, label)
+			}
+			if _, ok := labels[label]; ok {
+				return nil, fmt.Errorf("line %d: duplicate label %q", no, label)
+			}
+			labels[label] = len(lines)
+			tokens = tokens[1:]
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+		if strings.EqualFold(tokens[0], ".const") {
+			if len(tokens) != 3 || !isIdent(tokens[1]) {
+				return nil, fmt.Errorf("line %d: usage: .const NAME VALUE", no)
+			}
+			if _, ok := consts[tokens[1]]; ok {
+				return nil, fmt.Errorf("line %d: duplicate constant %q", no, tokens[1])
+			}
+			consts[tokens[1]] = tokens[2]
+			continue
+		}
+		lines = append(lines, line{no: no, name: strings.ToUpper(tokens[0]), tokens: tokens[1:]})
+	}
+
+	// 第二遍：按操作码的参数类型解析参数
+	code := make([]common.Opcode, len(lines))
+	for i, l := range lines {
+		op, ok := opcodeTable[l.name]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown opcode %q", l.no, l.name)
+		}
+		if len(l.tokens) != len(op.args) {
+			return nil, fmt.Errorf("line %d: %s takes %d operands, got %d", l.no, l.name, len(op.args), len(l.tokens))
+		}
+		code[i].Name = l.name
+		if len(op.args) == 0 {
+			continue
+		}
+		code[i].Args = make([]interface{}, len(op.args))
+		for j, kind := range op.args {
+			tok := l.tokens[j]
+			if v, ok := consts[tok]; ok {
+				tok = v
+			}
+			arg, err := parseOperand(tok, kind, labels)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s operand %d: %v", l.no, l.name, j+1, err)
+			}
+			code[i].Args[j] = arg
+		}
+	}
+	return code, nil
+}
+
+// Disassemble 将操作码序列还原为汇编源码，跳转目标以 L<下标> 形式的标签给出。
+// 输出可以被 Assemble 重新汇编为相同的操作码序列。
+func Disassemble(code []common.Opcode) (string, error) {
+	targets := make(map[int]bool)
+	for i, opcode := range code {
+		op, ok := opcodeTable[opcode.Name]
+		if !ok {
+			return "", fmt.Errorf("instruction %d: unknown opcode %q", i, opcode.Name)
+		}
+		if len(opcode.Args) != len(op.args) {
+			return "", fmt.Errorf("instruction %d: %s takes %d operands, got %d", i, opcode.Name, len(op.args), len(opcode.Args))
+		}
+		for j, kind := range op.args {
+			if kind != ArgTarget {
+				continue
+			}
+			target, ok := opcode.Args[j].(int)
+			if !ok {
+				return "", fmt.Errorf("instruction %d: %s operand %d is %T, want int", i, opcode.Name, j+1, opcode.Args[j])
+			}
+			if target >= 0 && target <= len(code) {
+				targets[target] = true
+			}
+		}
+	}
+
+	sb := strings.Builder{}
+	for i, opcode := range code {
+		if targets[i] {
+			fmt.Fprintf(&sb, "L%d:\n", i)
+		}
+		sb.WriteString("\t")
+		sb.WriteString(opcode.Name)
+		for j, kind := range opcodeTable[opcode.Name].args {
+			s, err := formatOperand(opcode.Args[j], kind, len(code))
+			if err != nil {
+				return "", fmt.Errorf("instruction %d: %s operand %d: %v", i, opcode.Name, j+1, err)
+			}
+			if j == 0 {
+				sb.WriteString(" ")
+			} else {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(s)
+		}
+		sb.WriteString("\n")
+	}
+	if targets[len(code)] {
+		fmt.Fprintf(&sb, "L%d:\n", len(code))
+	}
+	return sb.String(), nil
+}
+
+// FormatOpcode 以汇编语法格式化单条指令，跳转目标以数字形式给出
+func FormatOpcode(opcode common.Opcode) string {
+	sb := strings.Builder{}
+	sb.WriteString(opcode.Name)
+	kinds := opcodeTable[opcode.Name].args
+	for j, arg := range opcode.Args {
+		s := fmt.Sprint(arg)
+		if j < len(kinds) {
+			if f, err := formatOperand(arg, kinds[j], -1); err == nil {
+				s = f
+			}
+		}
+		if j == 0 {
+			sb.WriteString(" ")
+		} else {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(s)
+	}
+	return sb.String()
+}
+
+// Opcodes 返回所有已知操作码的名字，按字母序排列
+func Opcodes() []string {
+	names := make([]string, 0, len(opcodeTable))
+	for name := range opcodeTable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tokenize 按空白和逗号切分一行源码，去掉注释，保留带引号的字符串
+func tokenize(raw string) ([]string, error) {
+	tokens := make([]string, 0)
+	cur := strings.Builder{}
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+	for i := 0; i < len(raw); i++ {
+		ch := raw[i]
+		switch {
+		case ch == ';' || ch == '#':
+			flush()
+			return tokens, nil
+		case ch == '"':
+			flush()
+			end := i + 1
+			for ; end < len(raw) && raw[end] != '"'; end++ {
+				if raw[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(raw) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, raw[i:end+1])
+			i = end
+		case ch == ',' || unicode.IsSpace(rune(ch)):
+			flush()
+		default:
+			cur.WriteByte(ch)
+		}
+	}
+	flush()
+	return tokens, nil
+}
+
+func parseOperand(tok string, kind ArgKind, labels map[string]int) (interface{}, error) {
+	switch kind {
+	case ArgUint64:
+		if target, ok := labels[tok]; ok {
+			return uint64(target), nil
+		}
+		v, err := strconv.ParseUint(tok, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uint64 %q", tok)
+		}
+		return v, nil
+	case ArgTarget:
+		if target, ok := labels[tok]; ok {
+			return target, nil
+		}
+		v, err := strconv.ParseInt(tok, 0, 0)
+		if err != nil {
+			return nil, fmt.Errorf("undefined label %q", tok)
+		}
+		return int(v), nil
+	case ArgBytes:
+		if strings.HasPrefix(tok, "\"") {
+			s, err := strconv.Unquote(tok)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", tok)
+			}
+			return []byte(s), nil
+		}
+		if strings.HasPrefix(tok, "0x") || strings.HasPrefix(tok, "0X") {
+			b, err := hex.DecodeString(tok[2:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid hex %q", tok)
+			}
+			return b, nil
+		}
+		return nil, fmt.Errorf("bytes operand must be 0x-hex or a quoted string, got %q", tok)
+	}
+	return nil, fmt.Errorf("unknown operand kind %v", kind)
+}
+
+func formatOperand(arg interface{}, kind ArgKind, codeLen int) (string, error) {
+	switch kind {
+	case ArgUint64:
+		if v, ok := arg.(uint64); ok {
+			return strconv.FormatUint(v, 10), nil
+		}
+	case ArgTarget:
+		if v, ok := arg.(int); ok {
+			if v >= 0 && v <= codeLen {
+				return fmt.Sprintf("L%d", v), nil
+			}
+			return strconv.Itoa(v), nil
+		}
+	case ArgBytes:
+		if v, ok := arg.([]byte); ok {
+			if len(v) == 0 {
+				return `""`, nil
+			}
+			return "0x" + hex.EncodeToString(v), nil
+		}
+	}
+	return "", fmt.Errorf("%T is not a valid %v operand", arg, kind)
+}
+
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
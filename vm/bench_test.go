@@ -0,0 +1,99 @@
+package vm
+
+import (
+	"neochain/common"
+	"testing"
+)
+
+// stepCounter 统计执行过的指令数
+type stepCounter struct{ steps uint64 }
+
+func (c *stepCounter) OnStep(ctx *Context, op common.Opcode, cost uint64) { c.steps++ }
+func (c *stepCounter) OnMemoryWrite(offset uint64, data []byte)           {}
+func (c *stepCounter) OnError(ctx *Context, err error)                    {}
+func (c *stepCounter) OnExit(result *ExecutionResult, err error)          {}
+
+// benchmarkProgram 反复执行 src，并以 instr/s 报告每秒执行的指令数。
+// 指令数在计时之外用 stepCounter 统计一次，计时循环中不挂 Tracer。
+func benchmarkProgram(b *testing.B, src string) {
+	code, err := Assemble(src)
+	if err != nil {
+		b.Fatal(err)
+	}
+	tx := &common.Transaction{Code: code, GasLimit: 1 << 40}
+	engine := NewVM(make([]byte, 256))
+	counter := &stepCounter{}
+	engine.Tracer = counter
+	if _, err := engine.ExecuteTransaction(tx); err != nil {
+		b.Fatal(err)
+	}
+	engine.Tracer = nil
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := engine.ExecuteTransaction(tx); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(counter.steps)*float64(b.N)/b.Elapsed().Seconds(), "instr/s")
+}
+
+// BenchmarkArithLoop 是以栈运算与跳转为主的计数循环
+func BenchmarkArithLoop(b *testing.B) {
+	benchmarkProgram(b, `
+		PUSH 0
+	loop:
+		DUP
+		PUSH 3
+		MUL
+		PUSH 7
+		DIV
+		POP
+		PUSH 1
+		ADD
+		JEQ done, 10000
+		JMP loop
+	done:
+	`)
+}
+
+// BenchmarkMemoryLoop 在循环中读写内存
+func BenchmarkMemoryLoop(b *testing.B) {
+	benchmarkProgram(b, `
+		PUSH 0
+	loop:
+		LOAD 0, 8
+		PUSH 1
+		ADD
+		STORE 0
+		POP
+		PUSH 1
+		ADD
+		JEQ done, 5000
+		JMP loop
+	done:
+	`)
+}
+
+// BenchmarkShortTransaction 是只有几条指令的短交易，执行前后的固定开销占主导
+func BenchmarkShortTransaction(b *testing.B) {
+	benchmarkProgram(b, `
+		PUSH 2
+		PUSH 3
+		ADD
+		STORE 0
+		STOREI 8 0xcafe
+		LOAD 0, 16
+	`)
+}
+
+// BenchmarkStorageTransaction 执行 NewWorkTransaction 生成的状态读写交易，不含合成计算
+func BenchmarkStorageTransaction(b *testing.B) {
+	tx := common.NewWorkTransaction(1, 2, 0)
+	src, err := Disassemble(tx.Code)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkProgram(b, src)
+}
@@ -0,0 +1,46 @@
+package vm
+
+import (
+	"neochain/common"
+	"neochain/utils"
+)
+
+// CallDataSlot 是 CALLDATALOAD 每次读取的字节数。调用数据按 32 字节的槽位编码，
+// 与栈的位宽无关，因此同一份调用数据在 64 位与 256 位模式下都能读取
+const CallDataSlot = 32
+
+// callDataLoad 弹出偏移量，将调用数据中从该处开始的 32 字节作为大端序整数压入栈，
+// 超出调用数据的部分按 0 补齐，64 位模式下只保留低 64 位
+func callDataLoad(ctx *Context, in *Instruction) error {
+	offset := ctx.PopUint64()
+	slot := make([]byte, CallDataSlot)
+	if offset < uint64(len(ctx.CallData)) {
+		copy(slot, ctx.CallData[offset:])
+	}
+	ctx.Push(ctx.mask(utils.BytesToWord(slot)))
+	return nil
+}
+
+func callDataSize(ctx *Context, in *Instruction) error {
+	ctx.Push(common.NewWord(uint64(len(ctx.CallData))))
+	return nil
+}
+
+// callDataCopy 将调用数据复制到内存，栈顶依次为内存偏移量、调用数据偏移量与长度，
+// 超出调用数据的部分按 0 补齐。复制的数据按字收费
+func callDataCopy(ctx *Context, in *Instruction) error {
+	memOffset := ctx.PopUint64()
+	dataOffset := ctx.PopUint64()
+	length := ctx.PopUint64()
+	if !ctx.Memory.inBounds(memOffset, length) {
+		return ErrMemoryOutOfBounds
+	}
+	if err := ctx.useDynamicGas(GasCopyWord*dataWords(length), "CALLDATACOPY"); err != nil {
+		return err
+	}
+	data := make([]byte, length)
+	if dataOffset < uint64(len(ctx.CallData)) {
+		copy(data, ctx.CallData[dataOffset:])
+	}
+	return ctx.Memory.Store(memOffset, data)
+}
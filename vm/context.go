@@ -1,50 +1,109 @@
 package vm
 
+import (
+	"math"
+	"neochain/common"
+)
+
 // Context 保存执行环境中的所有状态
 type Context struct {
-	Memory *Memory  // 内存，用于存储变量和程序状态
-	Stack  []uint64 // 栈，用于保存临时数据和操作数
-	PC     int      // 程序计数器，用于控制程序的执行顺序
+	Memory *Memory       // 内存，用于存储变量和程序状态
+	Stack  []Word        // 栈，用于保存临时数据和操作数
+	PC     int           // 程序计数器，用于控制程序的执行顺序
+	Gas    uint64        // 剩余可用的 gas
+	State  *OverlayState // 当前交易的状态视图，交易成功后才写入 VM.State
+
+	Address    string       // 正在执行的合约地址，直接执行代码的交易为空
+	ReturnData []byte       // 当前帧 RETURN 的数据，或最近一次 CALL 的返回数据
+	Logs       []common.Log // 当前帧及其成功的子调用产生的事件日志
+	CallData   []byte       // 当前帧的输入：顶层为交易的 Data，被调用的合约为 CALL 的参数
+	Caller     Word         // 当前帧的调用方，见 caller
+
+	jumped   bool   // 当前指令是否修改了 PC，修改过则不再自增
+	halted   bool   // 当前帧已经 RETURN
+	depth    int    // 调用深度，顶层为 0
+	gasLimit uint64 // 当前帧开始执行时的 gas
+	vm       *VM    // 执行当前帧的 VM，供 CALL 使用
+
+	wordSize WordSize // 栈元素的位宽
+	checked  bool     // 算术溢出时是否报错
 }
 
 // NewContext 创建并初始化一个新的执行环境
 func NewContext(cell []byte) *Context {
 	return &Context{
 		Memory: NewMemory(cell),
-		Stack:  make([]uint64, 0),
+		Stack:  make([]Word, 0),
 		PC:     0,
 	}
 }
 
-// Push 将值压入栈顶
-func (c *Context) Push(value uint64) {
+// Push 将值压入栈顶，栈已满时以 ErrStackOverflow panic
+func (c *Context) Push(value Word) {
+	if len(c.Stack) >= MaxStackDepth {
+		panic(ErrStackOverflow)
+	}
 	c.Stack = append(c.Stack, value)
 }
 
-// Pop 从栈顶弹出值
-func (c *Context) Pop() uint64 {
+// Pop 从栈顶弹出值，栈为空时以 ErrStackUnderflow panic
+func (c *Context) Pop() Word {
 	if len(c.Stack) == 0 {
-		panic("pop from an empty stack")
+		panic(ErrStackUnderflow)
 	}
 	value := c.Stack[len(c.Stack)-1]
 	c.Stack = c.Stack[:len(c.Stack)-1]
 	return value
 }
 
-// Peek 从栈顶取值但不弹出
-func (c *Context) Peek() uint64 {
+// Peek 从栈顶取值但不弹出，栈为空时以 ErrStackUnderflow panic
+func (c *Context) Peek() Word {
 	if len(c.Stack) == 0 {
-		panic("peek from an empty stack")
+		panic(ErrStackUnderflow)
 	}
 	return c.Stack[len(c.Stack)-1]
 }
 
+// PopUint64 从栈顶弹出值并转换为 uint64，用于内存偏移、长度等参数。
+// 超出 uint64 的值视为 MaxUint64，用作偏移或长度时必然越界。
+func (c *Context) PopUint64() uint64 {
+	value := c.Pop()
+	if !value.IsUint64() {
+		return math.MaxUint64
+	}
+	return value.Uint64()
+}
+
+// Depth 返回当前帧的调用深度，顶层为 0
+func (c *Context) Depth() int {
+	return c.depth
+}
+
+// useDynamicGas 扣除由操作数决定的额外 gas，不足时返回 *OutOfGasError
+func (c *Context) useDynamicGas(amount uint64, opcode string) error {
+	if !c.UseGas(amount) {
+		c.Gas = 0
+		return &OutOfGasError{PC: c.PC, Opcode: opcode, Limit: c.gasLimit}
+	}
+	return nil
+}
+
 // IncrementPC 增加程序计数器
 func (c *Context) IncrementPC() {
 	c.PC++
 }
 
-// SetPC 设置程序计数器的值
+// SetPC 设置程序计数器的值，下一条执行的指令即为 newPC
 func (c *Context) SetPC(newPC int) {
 	c.PC = newPC
+	c.jumped = true
+}
+
+// UseGas 扣除 gas，剩余 gas 不足时返回 false 且不扣除
+func (c *Context) UseGas(amount uint64) bool {
+	if c.Gas < amount {
+		return false
+	}
+	c.Gas -= amount
+	return true
 }
@@ -0,0 +1,202 @@
+package vm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"neochain/common"
+	"neochain/utils"
+)
+
+// MaxCallDepth 是 CALL 允许的最大嵌套深度
+const MaxCallDepth = 64
+
+var (
+	ErrContractExists = errors.New("contract already deployed")
+	ErrNoContract     = errors.New("no contract at address")
+	ErrCallDepth      = errors.New("max call depth exceeded")
+)
+
+// ContractAddress 计算 deployer 第 nonce 次（从 0 开始）部署的合约地址，txHash 为部署交易的哈希：
+// deployer 的 32 字节大端序表示、8 字节大端序 nonce 与 txHash 拼接后 SHA-256 的前 20 字节的十六进制。
+// 同一段代码可以部署多次，每次得到不同的地址。
+// 发送方由客户端声明、没有经过认证，任何人都可以以他人的名义部署并推进其 nonce；
+// txHash 由提交层根据交易在区块中的位置与内容计算，客户端无法为另一笔部署交易预先占用它的地址
+func ContractAddress(deployer Word, nonce uint64, txHash []byte) string {
+	data := append(utils.WordToBytes(deployer), utils.UintToBytes(nonce)...)
+	sum := sha256.Sum256(append(data, txHash...))
+	return hex.EncodeToString(sum[:20])
+}
+
+// CodeKey 返回地址为 address 的合约的字节码在状态中的键
+func CodeKey(address string) string {
+	return "code/" + address
+}
+
+// NonceKey 返回 deployer 已部署的合约个数在状态中的键，值为 8 字节大端序整数
+func NonceKey(deployer Word) string {
+	return "nonce/" + deployer.Hex()
+}
+
+// nextAddress 返回 deployer 在哈希为 txHash 的交易中部署的合约地址与部署之后的 nonce
+func nextAddress(state State, deployer Word, txHash []byte) (string, uint64, error) {
+	value, err := state.Get(NonceKey(deployer))
+	if err != nil {
+		return "", 0, err
+	}
+	nonce := utils.BytesToInt(value)
+	return ContractAddress(deployer, nonce, txHash), nonce + 1, nil
+}
+
+// deploy 校验并将 code 以二进制字节码的形式保存在状态中，返回合约地址。
+// 部署方为交易的发送方，地址由部署方、其 nonce 与交易哈希决定，见 ContractAddress
+func deploy(ctx *Context, code []common.Opcode) (string, error) {
+	if err := Verify(code); err != nil {
+		return "", err
+	}
+	bytecode, err := common.EncodeCode(code)
+	if err != nil {
+		return "", err
+	}
+	if limit := ctx.Gas; !ctx.UseGas(GasDeploy + GasCodeByte*uint64(len(bytecode))) {
+		ctx.Gas = 0
+		return "", &OutOfGasError{Opcode: "DEPLOY", Limit: limit}
+	}
+	address, nonce, err := nextAddress(ctx.State, ctx.Caller, ctx.vm.Block.TxHash)
+	if err != nil {
+		return "", err
+	}
+	existing, err := ctx.State.Get(CodeKey(address))
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		return "", fmt.Errorf("%w: %s", ErrContractExists, address)
+	}
+	if err := ctx.State.Put(NonceKey(ctx.Caller), utils.UintToBytes(nonce)); err != nil {
+		return "", err
+	}
+	return address, ctx.State.Put(CodeKey(address), bytecode)
+}
+
+// loadContract 从状态中读取地址为 address 的合约代码并预解码
+func loadContract(state State, address string) (*Program, error) {
+	bytecode, err := state.Get(CodeKey(address))
+	if err != nil {
+		return nil, err
+	}
+	if bytecode == nil {
+		return nil, fmt.Errorf("%w: %q", ErrNoContract, address)
+	}
+	code, err := common.DecodeCode(bytecode)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(code)
+}
+
+// call 以独立的调用帧执行立即数给出的地址处的合约。
+// 栈顶依次为参数在内存中的偏移量与长度，参数被复制为被调用方的初始内存，同时作为其调用数据。
+// 复制参数按字收费，被调用方超出 32 字节的初始内存按内存扩展的价格收费。
+// 被调用方获得调用方剩余的全部 gas，拥有自己的栈、内存与状态写缓冲；
+// 成功时其状态写入并入调用方并压入 1，失败时写入被丢弃并压入 0。
+// 返回数据可通过 RETURNDATASIZE/RETURNDATACOPY 读取。
+// 地址为预编译合约时不创建调用帧，直接执行其 Go 实现，见 precompiles。
+func call(ctx *Context, in *Instruction) error {
+	address := string(in.Bytes)
+	inOffset := ctx.PopUint64()
+	inLength := ctx.PopUint64()
+	if !ctx.Memory.inBounds(inOffset, inLength) {
+		return ErrMemoryOutOfBounds
+	}
+	if err := ctx.useDynamicGas(GasCopyWord*dataWords(inLength), "CALL"); err != nil {
+		return err
+	}
+	input, err := ctx.Memory.Copy(inOffset, inLength)
+	if err != nil {
+		return err
+	}
+	ctx.ReturnData = nil
+	if ctx.depth+1 > MaxCallDepth {
+		return ErrCallDepth
+	}
+	if p, ok := precompiles[address]; ok {
+		return callPrecompile(ctx, p, input)
+	}
+	prog, err := loadContract(ctx.State, address)
+	if err != nil {
+		return err
+	}
+	if err := ctx.useDynamicGas(memoryExpansionGas(32, inLength), "CALL"); err != nil {
+		return err
+	}
+
+	child := &Context{
+		Memory:   NewMemory(input),
+		Stack:    make([]Word, 0),
+		CallData: input,
+		Caller:   ctx.Caller,
+		Gas:      ctx.Gas,
+		State:    NewOverlayState(ctx.State),
+		Address:  address,
+		depth:    ctx.depth + 1,
+		vm:       ctx.vm,
+
+		wordSize: ctx.wordSize,
+		checked:  ctx.checked,
+	}
+	if ctx.Address != "" {
+		child.Caller = AddressWord(ctx.Address)
+	}
+	child.Memory.Limit = ctx.Memory.Limit
+	child.Memory.onWrite = ctx.Memory.onWrite
+	err = ctx.vm.run(child, prog)
+	ctx.Gas = child.Gas
+	ctx.State.absorbReads(child.State)
+	if err == nil {
+		err = child.State.Flush()
+	}
+	if err != nil {
+		if ctx.vm.Tracer != nil {
+			ctx.vm.Tracer.OnError(child, err)
+		}
+		ctx.Push(Word{0})
+		return nil
+	}
+	ctx.ReturnData = child.ReturnData
+	ctx.Logs = append(ctx.Logs, child.Logs...)
+	ctx.Push(Word{1})
+	return nil
+}
+
+// ret 结束当前帧，栈顶依次为返回数据在内存中的偏移量与长度
+func ret(ctx *Context, in *Instruction) error {
+	offset := ctx.PopUint64()
+	length := ctx.PopUint64()
+	data, err := ctx.Memory.Copy(offset, length)
+	if err != nil {
+		return err
+	}
+	ctx.ReturnData = data
+	ctx.halted = true
+	return nil
+}
+
+func returnDataSize(ctx *Context, in *Instruction) error {
+	ctx.Push(common.NewWord(uint64(len(ctx.ReturnData))))
+	return nil
+}
+
+// returnDataCopy 将最近一次 CALL 的返回数据复制到栈顶给出的内存偏移量处，按字收费
+func returnDataCopy(ctx *Context, in *Instruction) error {
+	offset := ctx.PopUint64()
+	length := uint64(len(ctx.ReturnData))
+	if !ctx.Memory.inBounds(offset, length) {
+		return ErrMemoryOutOfBounds
+	}
+	if err := ctx.useDynamicGas(GasCopyWord*dataWords(length), "RETURNDATACOPY"); err != nil {
+		return err
+	}
+	return ctx.Memory.Store(offset, ctx.ReturnData)
+}
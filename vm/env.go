@@ -0,0 +1,59 @@
+package vm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"neochain/common"
+	"neochain/utils"
+)
+
+// BlockContext 是交易执行时所在区块与交易本身的环境，由提交层在执行前设置在 VM 上，
+// 供 HEIGHT、TIMESTAMP、PREVHASH、TXHASH 与 CALLER 读取。
+// 所有字段都必须由所有节点一致的数据得到，不能来自节点本地的时钟或状态。
+type BlockContext struct {
+	Height    uint64 // 区块高度
+	Timestamp uint64 // 排序层给出的区块时间，Unix 秒
+	PrevHash  []byte // 上一区块的哈希
+	TxHash    []byte // 当前交易的哈希
+	Caller    Word   // 交易声明的发送方，没有经过认证，不能用于权限判断
+}
+
+// AddressWord 将合约地址转换为 CALLER 压入栈的值：十六进制地址按大端序解释，
+// 其他地址（如预编译合约的名字）取其 SHA-256
+func AddressWord(address string) Word {
+	b, err := hex.DecodeString(address)
+	if err != nil || len(b) > 32 {
+		sum := sha256.Sum256([]byte(address))
+		b = sum[:]
+	}
+	return utils.BytesToWord(b)
+}
+
+func height(ctx *Context, in *Instruction) error {
+	ctx.Push(ctx.mask(common.NewWord(ctx.vm.Block.Height)))
+	return nil
+}
+
+func timestamp(ctx *Context, in *Instruction) error {
+	ctx.Push(ctx.mask(common.NewWord(ctx.vm.Block.Timestamp)))
+	return nil
+}
+
+// prevHash 压入上一区块的哈希，64 位模式下只保留低 64 位
+func prevHash(ctx *Context, in *Instruction) error {
+	ctx.Push(ctx.mask(utils.BytesToWord(ctx.vm.Block.PrevHash)))
+	return nil
+}
+
+// txHash 压入当前交易的哈希，64 位模式下只保留低 64 位
+func txHash(ctx *Context, in *Instruction) error {
+	ctx.Push(ctx.mask(utils.BytesToWord(ctx.vm.Block.TxHash)))
+	return nil
+}
+
+// caller 压入当前帧的调用方：顶层为交易声明的发送方，被调用的合约中为调用它的合约地址。
+// 交易的发送方由客户端任意填写，合约不能依赖顶层的 CALLER 判断权限
+func caller(ctx *Context, in *Instruction) error {
+	ctx.Push(ctx.mask(ctx.Caller))
+	return nil
+}
@@ -0,0 +1,726 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+	"neochain/common"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// 差分模糊测试：由模糊输入生成能通过 Verify 的随机程序，分别在生产解释器与参考解释器 refMachine
+// 上执行，比较最终的栈、内存与错误类别。种子语料在 testdata/fuzz 中，go test 会把它们作为回归用例执行，
+// 用 go test ./vm -run '^$' -fuzz FuzzInterpreter 持续生成新的输入。
+// 输入按 fuzzOps 中的下标选择操作码，增删操作码后语料仍然是有效的输入，只是对应的程序会改变。
+
+const (
+	fuzzMaxSteps  = 2048    // 两个解释器共同的指令条数上限，随机的向后跳转常常构成死循环
+	fuzzMaxMemory = 1 << 16 // MALLOC 的上限，避免随机的大小分配过多内存
+)
+
+// fuzzExcluded 是不参与差分测试的内置操作码
+var fuzzExcluded = map[string]string{
+	"CALL": "needs deployed contracts and a second call frame; covered by TestDeployAndCall",
+}
+
+// fuzzOps 返回生成程序时可以选择的操作码，按名字排序，不含扩展操作码
+func fuzzOps() []string {
+	names := make([]string, 0, len(opcodeTable))
+	for name, op := range opcodeTable {
+		if _, ok := fuzzExcluded[name]; !ok && !op.extension {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fuzzBlock 是两个解释器共同的区块环境
+var fuzzBlock = BlockContext{
+	Height:    12,
+	Timestamp: 1700000000,
+	PrevHash:  bytes.Repeat([]byte{0xab}, 32),
+	TxHash:    bytes.Repeat([]byte{0xcd}, 32),
+	Caller:    Word{7, 0, 0, 1 << 63},
+}
+
+// fuzzReader 从模糊输入中按需读取，输入耗尽后读到 0
+type fuzzReader struct{ b []byte }
+
+func (r *fuzzReader) byte() byte {
+	if len(r.b) == 0 {
+		return 0
+	}
+	c := r.b[0]
+	r.b = r.b[1:]
+	return c
+}
+
+// uint64 多数时候返回较小的值，使内存偏移量与跳转条件有机会命中有效的范围
+func (r *fuzzReader) uint64() uint64 {
+	switch r.byte() % 4 {
+	case 0, 1:
+		return uint64(r.byte() % 64)
+	case 2:
+		return uint64(r.byte())
+	}
+	var b [8]byte
+	for i := range b {
+		b[i] = r.byte()
+	}
+	return binary.BigEndian.Uint64(b[:])
+}
+
+func (r *fuzzReader) bytes(max int) []byte {
+	b := make([]byte, int(r.byte())%(max+1))
+	for i := range b {
+		b[i] = r.byte()
+	}
+	return b
+}
+
+// genProgram 由模糊输入生成一个能通过 Verify 的程序：先按输入选择操作码与参数，
+// 再把校验时栈下溢的指令逐个替换为 PUSH 0，替换不改变指令下标，因此跳转目标仍然有效
+func genProgram(input []byte) []common.Opcode {
+	r := &fuzzReader{input}
+	ops := fuzzOps()
+	n := int(r.byte()%48) + 1
+	code := make([]common.Opcode, n)
+	for i := range code {
+		name := ops[int(r.byte())%len(ops)]
+		op := opcodeTable[name]
+		var args []interface{} // 与汇编器一致，没有参数时为 nil
+		if len(op.args) > 0 {
+			args = make([]interface{}, len(op.args))
+		}
+		for j, kind := range op.args {
+			switch kind {
+			case ArgUint64:
+				v := r.uint64()
+				switch {
+				case name == "WORK":
+					v %= 256
+				case name == "LOAD" && j == 1:
+					v %= 48
+				}
+				args[j] = v
+			case ArgTarget:
+				args[j] = int(r.byte()) % (n + 1)
+			case ArgBytes:
+				if name == "PUSHW" {
+					args[j] = r.bytes(34)
+				} else {
+					args[j] = r.bytes(2)
+				}
+			}
+		}
+		code[i] = common.Opcode{Name: name, Args: args}
+	}
+	for {
+		var verr *VerifyError
+		if err := Verify(code); !errors.As(err, &verr) || !errors.Is(err, ErrStackUnderflow) {
+			return code
+		}
+		code[verr.PC] = common.Opcode{Name: "PUSH", Args: []interface{}{uint64(0)}}
+	}
+}
+
+// errorClass 返回错误所属的类别，两个解释器的错误类别必须相同，
+// 一致性测试向量也用它记录期望的错误
+func errorClass(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	for _, class := range []error{
+		ErrStackUnderflow, ErrStackOverflow, ErrDivisionByZero, ErrArithmeticOverflow,
+		ErrMemoryOutOfBounds, ErrOutOfMemory, ErrInvalidJump, ErrInvalidOperand,
+		ErrExecutionReverted, ErrStepLimit, ErrOutOfGas, ErrUnknownOpcode,
+	} {
+		if errors.Is(err, class) {
+			return class.Error()
+		}
+	}
+	return "unexpected: " + err.Error()
+}
+
+func FuzzInterpreter(f *testing.F) {
+	f.Fuzz(func(t *testing.T, program, memory, data []byte, wide, checked bool) {
+		code := genProgram(program)
+		size := Word64
+		if wide {
+			size = Word256
+		}
+
+		engine := NewVM(memory)
+		engine.WordSize = size
+		engine.CheckOverflow = checked
+		engine.MaxMemory = fuzzMaxMemory
+		engine.Block = fuzzBlock
+		tx := &common.Transaction{Code: code, GasLimit: math.MaxUint64, Data: data}
+		var err error
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("ExecuteTransaction panicked: %v\nprogram: %v", r, code)
+				}
+			}()
+			_, err = engine.ExecuteTransactionContext(context.Background(), tx, Limits{MaxSteps: fuzzMaxSteps})
+		}()
+
+		ref := newRefMachine(size, checked, memory, data)
+		refErr := ref.run(code)
+
+		if got, want := errorClass(err), errorClass(refErr); got != want {
+			t.Fatalf("error %q (%v), reference %q\nprogram: %v", got, err, want, code)
+		}
+		if got, want := engine.Context.Stack, ref.words(); !reflect.DeepEqual(append([]Word{}, got...), want) {
+			t.Fatalf("stack %v, reference %v\nprogram: %v", got, want, code)
+		}
+		if got := engine.Context.Memory.Cell; !bytes.Equal(got, ref.memory) {
+			t.Fatalf("memory %x, reference %x\nprogram: %v", got, ref.memory, code)
+		}
+	})
+}
+
+// FuzzAssembleRoundTrip 检查生成的程序经反汇编再汇编、编码再解码后保持不变
+func FuzzAssembleRoundTrip(f *testing.F) {
+	f.Fuzz(func(t *testing.T, program []byte) {
+		code := genProgram(program)
+		src, err := Disassemble(code)
+		if err != nil {
+			t.Fatalf("disassemble %v: %v", code, err)
+		}
+		back, err := Assemble(src)
+		if err != nil {
+			t.Fatalf("assemble %q: %v", src, err)
+		}
+		if !reflect.DeepEqual(back, code) {
+			t.Fatalf("assembled %v, want %v\nsource:\n%s", back, code, src)
+		}
+		bytecode, err := common.EncodeCode(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := common.DecodeCode(bytecode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, code) {
+			t.Fatalf("decoded %v, want %v", decoded, code)
+		}
+	})
+}
+
+// refMachine 是差分测试的参考解释器。它直接按操作码文档中的语义解释原始操作码，
+// 栈元素是 [0, 2^位宽) 内的 big.Int，不使用生产解释器的预解码、分派与定长算术。
+// 与生产解释器一样，操作码先弹出全部操作数再检查错误，出错时栈保持在出错的那一刻，内存恢复为初始内容。
+type refMachine struct {
+	bits    uint
+	checked bool
+	stack   []*big.Int
+	memory  []byte
+	initial []byte
+	data    []byte
+	state   map[string]*big.Int
+}
+
+func newRefMachine(size WordSize, checked bool, memory, data []byte) *refMachine {
+	mem := make([]byte, len(memory))
+	copy(mem, memory)
+	if len(mem) < 32 {
+		mem = append(mem, make([]byte, 32-len(mem))...)
+	}
+	return &refMachine{
+		bits:    uint(size),
+		checked: checked,
+		stack:   make([]*big.Int, 0),
+		memory:  mem,
+		initial: append([]byte{}, mem...),
+		data:    data,
+		state:   make(map[string]*big.Int),
+	}
+}
+
+// words 将参考解释器的栈转换为 Word，便于与生产解释器比较
+func (m *refMachine) words() []Word {
+	words := make([]Word, len(m.stack))
+	for i, v := range m.stack {
+		words[i] = common.WordFromBig(v)
+	}
+	return words
+}
+
+func (m *refMachine) modulus() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), m.bits)
+}
+
+// wrap 返回 x 按 2^位宽 取模的结果
+func (m *refMachine) wrap(x *big.Int) *big.Int {
+	return new(big.Int).Mod(x, m.modulus())
+}
+
+// signed 将栈上的值解释为当前位宽的补码
+func (m *refMachine) signed(x *big.Int) *big.Int {
+	if x.Bit(int(m.bits)-1) == 1 {
+		return new(big.Int).Sub(x, m.modulus())
+	}
+	return new(big.Int).Set(x)
+}
+
+func (m *refMachine) push(x *big.Int) error {
+	if len(m.stack) >= MaxStackDepth {
+		return ErrStackOverflow
+	}
+	m.stack = append(m.stack, x)
+	return nil
+}
+
+func (m *refMachine) pushBool(b bool) error {
+	if b {
+		return m.push(big.NewInt(1))
+	}
+	return m.push(big.NewInt(0))
+}
+
+// pushArith 压入真实的算术结果，超出位宽时按是否检查溢出报错或回绕
+func (m *refMachine) pushArith(x *big.Int) error {
+	if m.checked && (x.Sign() < 0 || x.Cmp(m.modulus()) >= 0) {
+		return ErrArithmeticOverflow
+	}
+	return m.push(m.wrap(x))
+}
+
+// pushSigned 压入真实的有符号结果，超出位宽的有符号范围时按是否检查溢出报错或回绕
+func (m *refMachine) pushSigned(x *big.Int) error {
+	half := new(big.Int).Lsh(big.NewInt(1), m.bits-1)
+	if m.checked && (x.Cmp(half) >= 0 || x.Cmp(new(big.Int).Neg(half)) < 0) {
+		return ErrArithmeticOverflow
+	}
+	return m.push(m.wrap(x))
+}
+
+func (m *refMachine) pop() (*big.Int, error) {
+	if len(m.stack) == 0 {
+		return nil, ErrStackUnderflow
+	}
+	x := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return x, nil
+}
+
+// popN 依次弹出 n 个元素，第一个是栈顶
+func (m *refMachine) popN(n int) ([]*big.Int, error) {
+	xs := make([]*big.Int, n)
+	for i := range xs {
+		x, err := m.pop()
+		if err != nil {
+			return nil, err
+		}
+		xs[i] = x
+	}
+	return xs, nil
+}
+
+// popUint64 弹出一个用作偏移量或长度的值，超出 uint64 的值视为 MaxUint64
+func (m *refMachine) popUint64() (uint64, error) {
+	x, err := m.pop()
+	if err != nil {
+		return 0, err
+	}
+	if !x.IsUint64() {
+		return math.MaxUint64, nil
+	}
+	return x.Uint64(), nil
+}
+
+func (m *refMachine) peek() (*big.Int, error) {
+	if len(m.stack) == 0 {
+		return nil, ErrStackUnderflow
+	}
+	return m.stack[len(m.stack)-1], nil
+}
+
+// span 返回内存 [offset, offset+length)，越界时返回 ErrMemoryOutOfBounds
+func (m *refMachine) span(offset, length uint64) ([]byte, error) {
+	end := new(big.Int).Add(new(big.Int).SetUint64(offset), new(big.Int).SetUint64(length))
+	if end.Cmp(big.NewInt(int64(len(m.memory)))) > 0 {
+		return nil, ErrMemoryOutOfBounds
+	}
+	return m.memory[offset : offset+length], nil
+}
+
+// wordBytes 返回 x 在内存中的大端序表示，长度为位宽的字节数
+func (m *refMachine) wordBytes(x *big.Int) []byte {
+	return x.FillBytes(make([]byte, m.bits/8))
+}
+
+func (m *refMachine) run(code []common.Opcode) error {
+	err := m.exec(code)
+	if err != nil {
+		m.memory = m.initial
+	}
+	return err
+}
+
+func (m *refMachine) exec(code []common.Opcode) error {
+	pc, steps := 0, 0
+	for pc != len(code) {
+		if pc < 0 || pc > len(code) {
+			return ErrInvalidJump
+		}
+		steps++
+		if steps > fuzzMaxSteps {
+			return ErrStepLimit
+		}
+		next, halt, err := m.step(pc, code[pc])
+		if err != nil || halt {
+			return err
+		}
+		pc = next
+	}
+	return nil
+}
+
+// refBinary 是 b op a 形式的二元操作码，a 为栈顶
+var refBinary = map[string]func(m *refMachine, a, b *big.Int) error{
+	"ADD": func(m *refMachine, a, b *big.Int) error { return m.pushArith(new(big.Int).Add(b, a)) },
+	"SUB": func(m *refMachine, a, b *big.Int) error { return m.pushArith(new(big.Int).Sub(b, a)) },
+	"MUL": func(m *refMachine, a, b *big.Int) error { return m.pushArith(new(big.Int).Mul(b, a)) },
+	"DIV": func(m *refMachine, a, b *big.Int) error {
+		if a.Sign() == 0 {
+			return ErrDivisionByZero
+		}
+		return m.push(new(big.Int).Quo(b, a))
+	},
+	"MOD": func(m *refMachine, a, b *big.Int) error {
+		if a.Sign() == 0 {
+			return ErrDivisionByZero
+		}
+		return m.push(new(big.Int).Rem(b, a))
+	},
+	"SDIV": func(m *refMachine, a, b *big.Int) error {
+		if a.Sign() == 0 {
+			return ErrDivisionByZero
+		}
+		return m.pushSigned(new(big.Int).Quo(m.signed(b), m.signed(a)))
+	},
+	"SMOD": func(m *refMachine, a, b *big.Int) error {
+		if a.Sign() == 0 {
+			return ErrDivisionByZero
+		}
+		return m.pushSigned(new(big.Int).Rem(m.signed(b), m.signed(a)))
+	},
+	"EXP": func(m *refMachine, a, b *big.Int) error {
+		// 底数不小于 2 且指数不小于位宽时真实结果必然超出位宽，不必求出它
+		if b.Cmp(big.NewInt(2)) >= 0 && a.Cmp(big.NewInt(int64(m.bits))) >= 0 {
+			if m.checked {
+				return ErrArithmeticOverflow
+			}
+			return m.push(new(big.Int).Exp(b, a, m.modulus()))
+		}
+		return m.pushArith(new(big.Int).Exp(b, a, nil))
+	},
+	"AND": func(m *refMachine, a, b *big.Int) error { return m.push(new(big.Int).And(b, a)) },
+	"OR":  func(m *refMachine, a, b *big.Int) error { return m.push(new(big.Int).Or(b, a)) },
+	"XOR": func(m *refMachine, a, b *big.Int) error { return m.push(new(big.Int).Xor(b, a)) },
+	"SHL": func(m *refMachine, a, b *big.Int) error {
+		if a.Cmp(big.NewInt(int64(m.bits))) >= 0 {
+			return m.push(big.NewInt(0))
+		}
+		return m.push(m.wrap(new(big.Int).Lsh(b, uint(a.Uint64()))))
+	},
+	"SHR": func(m *refMachine, a, b *big.Int) error {
+		if a.Cmp(big.NewInt(int64(m.bits))) >= 0 {
+			return m.push(big.NewInt(0))
+		}
+		return m.push(new(big.Int).Rsh(b, uint(a.Uint64())))
+	},
+	"SAR": func(m *refMachine, a, b *big.Int) error {
+		shift := uint(m.bits)
+		if a.Cmp(big.NewInt(int64(m.bits))) < 0 {
+			shift = uint(a.Uint64())
+		}
+		// big.Int 对负数右移时向负无穷取整，与补码的算术右移相同
+		return m.push(m.wrap(new(big.Int).Rsh(m.signed(b), shift)))
+	},
+	"LT":  func(m *refMachine, a, b *big.Int) error { return m.pushBool(b.Cmp(a) < 0) },
+	"GT":  func(m *refMachine, a, b *big.Int) error { return m.pushBool(b.Cmp(a) > 0) },
+	"SLT": func(m *refMachine, a, b *big.Int) error { return m.pushBool(m.signed(b).Cmp(m.signed(a)) < 0) },
+	"SGT": func(m *refMachine, a, b *big.Int) error { return m.pushBool(m.signed(b).Cmp(m.signed(a)) > 0) },
+	"EQ":  func(m *refMachine, a, b *big.Int) error { return m.pushBool(b.Cmp(a) == 0) },
+	"CMP": func(m *refMachine, a, b *big.Int) error { return m.pushBool(a.Cmp(b) < 0) },
+}
+
+// step 执行 code 中下标为 pc 的指令，返回下一条指令的下标，halt 为 true 表示当前帧已经 RETURN
+func (m *refMachine) step(pc int, opcode common.Opcode) (next int, halt bool, err error) {
+	next = pc + 1
+	args := opcode.Args
+	if f, ok := refBinary[opcode.Name]; ok {
+		ab, err := m.popN(2)
+		if err != nil {
+			return 0, false, err
+		}
+		return next, false, f(m, ab[0], ab[1])
+	}
+
+	switch name := opcode.Name; name {
+	case "NOT":
+		x, err := m.pop()
+		if err != nil {
+			return 0, false, err
+		}
+		return next, false, m.push(new(big.Int).Sub(new(big.Int).Sub(m.modulus(), big.NewInt(1)), x))
+	case "ISZERO":
+		x, err := m.pop()
+		if err != nil {
+			return 0, false, err
+		}
+		return next, false, m.pushBool(x.Sign() == 0)
+
+	case "PUSH":
+		return next, false, m.push(new(big.Int).SetUint64(args[0].(uint64)))
+	case "PUSHW":
+		data := args[0].([]byte)
+		if len(data) > 32 {
+			return 0, false, ErrInvalidOperand
+		}
+		return next, false, m.push(m.wrap(new(big.Int).SetBytes(data)))
+	case "POP":
+		_, err := m.pop()
+		return next, false, err
+
+	case "JMP":
+		return args[0].(int), false, nil
+	case "JEQ":
+		top, err := m.peek()
+		if err != nil {
+			return 0, false, err
+		}
+		if top.Cmp(new(big.Int).SetUint64(args[1].(uint64))) == 0 {
+			return args[0].(int), false, nil
+		}
+		return next, false, nil
+	case "JUMPI":
+		xs, err := m.popN(2)
+		if err != nil {
+			return 0, false, err
+		}
+		target, cond := xs[0], xs[1]
+		if cond.Sign() == 0 {
+			return next, false, nil
+		}
+		if target.Cmp(big.NewInt(math.MaxInt32)) > 0 {
+			return 0, false, ErrInvalidJump
+		}
+		return int(target.Int64()), false, nil
+	case "REVERT":
+		return 0, false, ErrExecutionReverted
+	case "RETURN":
+		offset, err := m.popUint64()
+		if err != nil {
+			return 0, false, err
+		}
+		length, err := m.popUint64()
+		if err != nil {
+			return 0, false, err
+		}
+		_, err = m.span(offset, length)
+		return 0, err == nil, err
+	case "WORK":
+		return next, false, nil
+
+	case "SLOAD":
+		slot, err := m.pop()
+		if err != nil {
+			return 0, false, err
+		}
+		value, ok := m.state[string(args[0].([]byte))+"\x00"+slot.String()]
+		if !ok {
+			value = big.NewInt(0)
+		}
+		return next, false, m.push(value)
+	case "SSTORE":
+		xs, err := m.popN(2)
+		if err != nil {
+			return 0, false, err
+		}
+		m.state[string(args[0].([]byte))+"\x00"+xs[0].String()] = xs[1]
+		return next, false, nil
+
+	case "LOAD":
+		offset, length := args[0].(uint64), args[1].(uint64)
+		data, err := m.span(offset, length)
+		if err != nil {
+			return 0, false, err
+		}
+		// 每 8 字节压入一个元素，最后不足 8 字节的部分按高位对齐
+		for i := 0; i < len(data); i += 8 {
+			chunk := make([]byte, 8)
+			copy(chunk, data[i:])
+			if err := m.push(new(big.Int).SetBytes(chunk)); err != nil {
+				return 0, false, err
+			}
+		}
+		return next, false, nil
+	case "STOREI":
+		data := args[1].([]byte)
+		dst, err := m.span(args[0].(uint64), uint64(len(data)))
+		if err != nil {
+			return 0, false, err
+		}
+		copy(dst, data)
+		return next, false, nil
+	case "STORE":
+		top, err := m.peek()
+		if err != nil {
+			return 0, false, err
+		}
+		dst, err := m.span(args[0].(uint64), uint64(m.bits/8))
+		if err != nil {
+			return 0, false, err
+		}
+		copy(dst, m.wordBytes(top))
+		return next, false, nil
+	case "LOADW":
+		data, err := m.span(args[0].(uint64), uint64(m.bits/8))
+		if err != nil {
+			return 0, false, err
+		}
+		return next, false, m.push(new(big.Int).SetBytes(data))
+	case "MALLOC":
+		size := args[0].(uint64)
+		offset := uint64(len(m.memory))
+		end := new(big.Int).Add(new(big.Int).SetUint64(offset), new(big.Int).SetUint64(size))
+		if end.Cmp(big.NewInt(fuzzMaxMemory)) > 0 && size > 0 {
+			return 0, false, ErrOutOfMemory
+		}
+		m.memory = append(m.memory, make([]byte, size)...)
+		return next, false, m.push(new(big.Int).SetUint64(offset))
+	case "HASH":
+		offset, err := m.popUint64()
+		if err != nil {
+			return 0, false, err
+		}
+		length, err := m.popUint64()
+		if err != nil {
+			return 0, false, err
+		}
+		data, err := m.span(offset, length)
+		if err != nil {
+			return 0, false, err
+		}
+		// 64 位模式取摘要的前 8 字节
+		digest := sha256.Sum256(data)
+		return next, false, m.push(new(big.Int).SetBytes(digest[:m.bits/8]))
+
+	case "CALLDATALOAD":
+		offset, err := m.popUint64()
+		if err != nil {
+			return 0, false, err
+		}
+		slot := make([]byte, 32)
+		if offset < uint64(len(m.data)) {
+			copy(slot, m.data[offset:])
+		}
+		return next, false, m.push(m.wrap(new(big.Int).SetBytes(slot)))
+	case "CALLDATASIZE":
+		return next, false, m.push(big.NewInt(int64(len(m.data))))
+	case "CALLDATACOPY":
+		xs := make([]uint64, 3)
+		for i := range xs {
+			if xs[i], err = m.popUint64(); err != nil {
+				return 0, false, err
+			}
+		}
+		dst, err := m.span(xs[0], xs[2])
+		if err != nil {
+			return 0, false, err
+		}
+		for i := range dst {
+			dst[i] = 0
+			if j := xs[1] + uint64(i); xs[1] < uint64(len(m.data)) && j < uint64(len(m.data)) {
+				dst[i] = m.data[j]
+			}
+		}
+		return next, false, nil
+	case "RETURNDATASIZE":
+		return next, false, m.push(big.NewInt(0))
+	case "RETURNDATACOPY":
+		offset, err := m.popUint64()
+		if err != nil {
+			return 0, false, err
+		}
+		_, err = m.span(offset, 0)
+		return next, false, err
+
+	case "HEIGHT":
+		return next, false, m.push(m.wrap(new(big.Int).SetUint64(fuzzBlock.Height)))
+	case "TIMESTAMP":
+		return next, false, m.push(m.wrap(new(big.Int).SetUint64(fuzzBlock.Timestamp)))
+	case "PREVHASH":
+		return next, false, m.push(m.wrap(new(big.Int).SetBytes(fuzzBlock.PrevHash)))
+	case "TXHASH":
+		return next, false, m.push(m.wrap(new(big.Int).SetBytes(fuzzBlock.TxHash)))
+	case "CALLER":
+		return next, false, m.push(m.wrap(fuzzBlock.Caller.Big()))
+	}
+
+	var n int
+	switch name := opcode.Name; {
+	case name == "DUP":
+		top, err := m.peek()
+		if err != nil {
+			return 0, false, err
+		}
+		return next, false, m.push(top)
+	case refNumbered(name, "DUP", &n):
+		if len(m.stack) < n {
+			return 0, false, ErrStackUnderflow
+		}
+		return next, false, m.push(m.stack[len(m.stack)-n])
+	case refNumbered(name, "SWAP", &n):
+		if len(m.stack) < n+1 {
+			return 0, false, ErrStackUnderflow
+		}
+		top := len(m.stack) - 1
+		m.stack[top], m.stack[top-n] = m.stack[top-n], m.stack[top]
+		return next, false, nil
+	case refNumbered(name, "LOG", &n):
+		offset, err := m.popUint64()
+		if err != nil {
+			return 0, false, err
+		}
+		length, err := m.popUint64()
+		if err != nil {
+			return 0, false, err
+		}
+		if _, err := m.popN(n); err != nil {
+			return 0, false, err
+		}
+		_, err = m.span(offset, length)
+		return next, false, err
+	}
+	panic("reference interpreter does not implement " + opcode.Name)
+}
+
+// refNumbered 判断 name 是否为 prefix 后接一个十进制数，如 DUP3，数写入 n
+func refNumbered(name, prefix string, n *int) bool {
+	if len(name) <= len(prefix) || name[:len(prefix)] != prefix {
+		return false
+	}
+	v := 0
+	for _, c := range name[len(prefix):] {
+		if c < '0' || c > '9' {
+			return false
+		}
+		v = v*10 + int(c-'0')
+	}
+	*n = v
+	return true
+}
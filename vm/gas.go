@@ -0,0 +1,85 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// 各类操作码的 gas 价格
+const (
+	GasQuick    uint64 = 2    // 纯栈操作
+	GasFastest  uint64 = 3    // 简单算术与比较
+	GasFast     uint64 = 5    // 乘除法
+	GasMid      uint64 = 8    // 跳转
+	GasExp      uint64 = 10   // 乘方的基础价格
+	GasExpByte  uint64 = 5    // 乘方时指数每个有效字节的价格
+	GasMemory   uint64 = 10   // 内存读写
+	GasAlloc    uint64 = 20   // 内存分配
+	GasSLoad    uint64 = 50   // 读取持久化状态
+	GasSStore   uint64 = 200  // 写入持久化状态
+	GasCall     uint64 = 100  // 调用合约，不含被调用方消耗的 gas
+	GasLog      uint64 = 50   // 事件日志的基础价格
+	GasLogTopic uint64 = 25   // 事件日志每个 topic 的价格
+	GasLogByte  uint64 = 2    // 事件日志每字节数据的价格
+	GasHash     uint64 = 30   // SHA-256 的基础价格
+	GasHashWord uint64 = 6    // 哈希或验签时每 32 字节数据的价格
+	GasEd25519  uint64 = 2000 // Ed25519 验签的基础价格
+	GasDeploy   uint64 = 1000 // 部署合约的基础价格
+	GasCodeByte uint64 = 10   // 部署合约时每字节字节码的价格
+	GasWork     uint64 = 2    // WORK 的基础价格
+	GasCopyWord uint64 = 3    // 写入内存或复制调用参数、调用数据、返回数据时每 32 字节的价格
+
+	GasMemoryWord uint64 = 3 // 内存扩展时每 32 字节的线性价格
+)
+
+// MemoryQuadDivisor 是内存扩展价格中平方项的除数：
+// 大小为 w 个 32 字节字的内存总价为 GasMemoryWord*w + w*w/MemoryQuadDivisor，
+// 扩展时扣除扩展前后总价之差，内存越大扩展越贵
+const MemoryQuadDivisor uint64 = 512
+
+// DefaultMaxMemory 是 NewVM 创建的执行引擎默认的内存上限
+const DefaultMaxMemory uint64 = 4 << 20
+
+// WorkPerGas 是 WORK 每消耗 1 gas 执行的迭代次数，不足的部分按 1 gas 计
+const WorkPerGas uint64 = 64
+
+// memoryGas 返回大小为 size 字节的内存的总价
+func memoryGas(size uint64) uint64 {
+	words := size/32 + 1
+	if size%32 == 0 {
+		words--
+	}
+	// 平方项在约 2^32 字时溢出，此时任何 gas 上限都不够支付
+	if words > math.MaxUint32 {
+		return math.MaxUint64
+	}
+	return words*GasMemoryWord + words*words/MemoryQuadDivisor
+}
+
+// memoryExpansionGas 返回内存从 from 字节扩展到 to 字节的价格
+func memoryExpansionGas(from uint64, to uint64) uint64 {
+	if to <= from {
+		return 0
+	}
+	return memoryGas(to) - memoryGas(from)
+}
+
+// ErrOutOfGas 在交易耗尽 gas 时返回，可用 errors.Is 判断。
+var ErrOutOfGas = errors.New("out of gas")
+
+// OutOfGasError 记录 gas 耗尽时的现场信息，均取自耗尽 gas 的调用帧。
+type OutOfGasError struct {
+	PC     int    // 耗尽 gas 时该帧的程序计数器
+	Opcode string // 耗尽 gas 的操作码
+	Limit  uint64 // 该帧开始执行时的 gas，顶层帧即交易的 gas 上限，CALL 的被调用方为调用时剩余的 gas
+}
+
+func (e *OutOfGasError) Error() string {
+	return fmt.Sprintf("out of gas: pc=%d opcode=%s limit=%d", e.PC, e.Opcode, e.Limit)
+}
+
+// Is 使 errors.Is(err, ErrOutOfGas) 成立
+func (e *OutOfGasError) Is(target error) bool {
+	return target == ErrOutOfGas
+}
@@ -0,0 +1,61 @@
+package vm
+
+// journalEntry 记录一次写入之前的内存状态，用于回滚
+type journalEntry struct {
+	offset uint64
+	old    []byte // 被覆盖的旧数据，为 nil 时表示这是一次扩容
+	oldLen int    // 扩容前的内存大小
+}
+
+// Checkpoint 创建一个检查点并返回其编号，之后的写入可以通过 RevertTo 撤销。
+// 检查点可以嵌套，编号从 0 开始递增。
+func (m *Memory) Checkpoint() int {
+	m.checkpoints = append(m.checkpoints, len(m.journal))
+	return len(m.checkpoints) - 1
+}
+
+// RevertTo 撤销检查点 id 之后的所有写入与扩容，并丢弃 id 及其之后的检查点
+func (m *Memory) RevertTo(id int) {
+	if id < 0 || id >= len(m.checkpoints) {
+		return
+	}
+	mark := m.checkpoints[id]
+	for i := len(m.journal) - 1; i >= mark; i-- {
+		entry := m.journal[i]
+		if entry.old == nil {
+			m.Cell = m.Cell[:entry.oldLen]
+		} else {
+			copy(m.Cell[entry.offset:], entry.old)
+		}
+	}
+	m.journal = m.journal[:mark]
+	m.checkpoints = m.checkpoints[:id]
+}
+
+// Commit 接受检查点 id 之后的写入，并丢弃 id 及其之后的检查点。
+// 外层检查点仍然可以撤销这些写入；没有剩余检查点时日志被清空。
+func (m *Memory) Commit(id int) {
+	if id < 0 || id >= len(m.checkpoints) {
+		return
+	}
+	m.checkpoints = m.checkpoints[:id]
+	if len(m.checkpoints) == 0 {
+		m.journal = m.journal[:0]
+	}
+}
+
+func (m *Memory) journalWrite(offset uint64, length uint64) {
+	if len(m.checkpoints) == 0 || length == 0 {
+		return
+	}
+	old := make([]byte, length)
+	copy(old, m.Cell[offset:offset+length])
+	m.journal = append(m.journal, journalEntry{offset: offset, old: old})
+}
+
+func (m *Memory) journalGrow() {
+	if len(m.checkpoints) == 0 {
+		return
+	}
+	m.journal = append(m.journal, journalEntry{oldLen: len(m.Cell)})
+}
@@ -0,0 +1,73 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"neochain/common"
+	"time"
+)
+
+// ErrStepLimit 在执行的指令条数超过 Limits.MaxSteps 时返回
+var ErrStepLimit = errors.New("step limit exceeded")
+
+// interruptInterval 是两次检查取消信号之间执行的指令条数，须为 2 的幂。
+// 每条指令都检查 channel 的开销与一条简单指令相当，因此按间隔检查
+const interruptInterval = 1024
+
+// workInterruptInterval 是 WORK 两次检查取消信号之间的迭代次数，须为 2 的幂
+const workInterruptInterval = 1 << 16
+
+// Limits 限制一次执行可以使用的资源，零值表示不限制
+type Limits struct {
+	// MaxSteps 是最多执行的指令条数，包括被调用合约中的指令。
+	// 它与 gas 一样只依赖交易本身，所有节点都会在同一条指令处中止
+	MaxSteps uint64
+	// Timeout 是执行的墙钟时间上限，超时后以 context.DeadlineExceeded 中止。
+	// 它取决于节点的负载，不同节点可能得到不同的结果
+	Timeout time.Duration
+}
+
+// ExecuteTransactionContext 与 ExecuteTransaction 相同，但会在 ctx 被取消、到达截止时间，
+// 或超过 limits 给出的限制时中止执行。中止的交易与其他出错的交易一样撤销所有写入，
+// 返回的错误可用 errors.Is 与 context.Canceled、context.DeadlineExceeded 或 ErrStepLimit 比较。
+// 取消信号每 interruptInterval 条指令检查一次，WORK 在迭代中也会检查。
+func (e *VM) ExecuteTransactionContext(ctx context.Context, t *common.Transaction, limits Limits) (*ExecutionResult, error) {
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+	e.ctx = ctx
+	e.done = ctx.Done()
+	e.maxSteps = limits.MaxSteps
+	e.limited = e.done != nil || e.maxSteps > 0
+	defer func() {
+		e.ctx, e.done, e.maxSteps, e.limited = nil, nil, 0, false
+	}()
+	return e.execute(t)
+}
+
+// checkLimits 在执行一条指令之前调用，e.steps 已经计入这条指令
+func (e *VM) checkLimits() error {
+	if e.maxSteps > 0 && e.steps > e.maxSteps {
+		return fmt.Errorf("%w: limit %d", ErrStepLimit, e.maxSteps)
+	}
+	if e.steps&(interruptInterval-1) == 1 {
+		return e.interrupted()
+	}
+	return nil
+}
+
+// interrupted 在执行被取消或超时时返回 ctx.Err()
+func (e *VM) interrupted() error {
+	if e == nil || e.done == nil {
+		return nil
+	}
+	select {
+	case <-e.done:
+		return e.ctx.Err()
+	default:
+		return nil
+	}
+}
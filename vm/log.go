@@ -0,0 +1,33 @@
+package vm
+
+import (
+	"fmt"
+	"neochain/common"
+)
+
+// makeLog 返回 LOGn 的处理函数。
+// 栈顶依次为数据在内存中的偏移量、长度以及 n 个 topic，数据在内存范围内时按字节额外收取 gas。
+// 日志记录在当前帧中，只有所在的调用与整个交易都成功时才会出现在执行结果里。
+func makeLog(n int) OpAction {
+	name := fmt.Sprintf("LOG%d", n)
+	return func(ctx *Context, in *Instruction) error {
+		offset := ctx.PopUint64()
+		length := ctx.PopUint64()
+		topics := make([]common.Word, n)
+		for i := range topics {
+			topics[i] = ctx.Pop()
+		}
+		if !ctx.Memory.inBounds(offset, length) {
+			return ErrMemoryOutOfBounds
+		}
+		if err := ctx.useDynamicGas(GasLogByte*length, name); err != nil {
+			return err
+		}
+		data, err := ctx.Memory.Copy(offset, length)
+		if err != nil {
+			return err
+		}
+		ctx.Logs = append(ctx.Logs, common.Log{Address: ctx.Address, Topics: topics, Data: data})
+		return nil
+	}
+}
@@ -1,18 +1,59 @@
 package vm
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	ErrOutOfMemory       = errors.New("out of memory")               // 扩展后的内存超过上限
+	ErrMemoryOutOfBounds = errors.New("memory access out of bounds") // 读写超出当前内存范围
+)
+
+// Range 表示内存中 [Offset, Offset+Length) 的一段字节
+type Range struct {
+	Offset uint64
+	Length uint64
+}
 
-var ErrOutOfMemory = errors.New("out of memory")
+func (r Range) String() string {
+	return fmt.Sprintf("%d:%d", r.Offset, r.Length)
+}
+
+// End 返回区间末尾（不含）的偏移量
+func (r Range) End() uint64 {
+	return r.Offset + r.Length
+}
+
+// Overlaps 判断两个区间是否有交集
+func (r Range) Overlaps(o Range) bool {
+	return r.Offset < o.End() && o.Offset < r.End()
+}
 
 // Memory 是一个封装了内存操作的结构体，其中 Cell 表示内存的字节数组。
+// 所有成功的读写都会被记录下来，用于得到交易真实的读写集。
 type Memory struct {
-	Cell []byte
+	Cell  []byte
+	Limit uint64 // 内存大小的上限，Malloc 不能使内存超过它；为 0 时不限制
+
+	reads  []Range
+	writes []Range
+
+	onWrite func(offset uint64, data []byte) // 写入后的回调，供 Tracer 使用
+
+	journal     []journalEntry // 自最早的检查点以来每次写入前的旧数据
+	checkpoints []int          // 每个检查点创建时 journal 的长度
 }
 
-// NewMemory 创建并返回一个新的 Memory 实例。
+// NewMemory 创建并返回一个新的 Memory 实例，内容为 cell 的副本，大小至少为 32 字节。
 func NewMemory(cell []byte) *Memory {
+	size := len(cell)
+	if size < 32 {
+		size = 32
+	}
 	mem := &Memory{
-		Cell: make([]byte, 32),
+		Cell: make([]byte, size),
 	}
 	copy(mem.Cell, cell)
 	return mem
@@ -31,61 +72,92 @@ func (m *Memory) WillIncrease(offset uint64, size uint64) (o uint64, s uint64, i
 }
 
 // Malloc 在指定偏移量和大小的基础上分配内存，如果当前内存不足，则增加内存。
-func (m *Memory) Malloc(offset uint64, size uint64) []byte {
+// 增长后的大小超过 Limit 时返回 ErrOutOfMemory，内存保持不变。
+func (m *Memory) Malloc(offset uint64, size uint64) ([]byte, error) {
+	if err := m.CheckGrow(offset, size); err != nil {
+		return nil, err
+	}
 	mLen := uint64(len(m.Cell))
 	bound := offset + size
 	if mLen < bound {
+		m.journalGrow()
 		newMem := make([]byte, bound-mLen) // 创建新的内存块以扩充内存
 		m.Cell = append(m.Cell, newMem...)
+		m.recordWrite(mLen, bound-mLen)
 	}
 
-	return m.Cell[offset:bound] // 返回新分配的内存块
+	return m.Cell[offset:bound], nil // 返回新分配的内存块
+}
+
+// CheckGrow 检查分配 [offset, offset+size) 后内存是否会超过 Limit，不需要增长时总是成功
+func (m *Memory) CheckGrow(offset uint64, size uint64) error {
+	bound := offset + size
+	if bound < offset {
+		return fmt.Errorf("%w: %d bytes at offset %d overflows", ErrOutOfMemory, size, offset)
+	}
+	if m.Limit > 0 && bound > m.Limit && bound > uint64(len(m.Cell)) {
+		return fmt.Errorf("%w: %d bytes requested, limit %d", ErrOutOfMemory, bound, m.Limit)
+	}
+	return nil
+}
+
+// inBounds 判断 [offset, offset+length) 是否落在当前内存内，offset+length 溢出时也返回 false
+func (m *Memory) inBounds(offset uint64, length uint64) bool {
+	size := uint64(len(m.Cell))
+	return offset <= size && length <= size-offset
 }
 
 // Map 返回从指定偏移量开始的指定长度的内存片段，如果超出范围，返回错误。
 func (m *Memory) Map(offset uint64, length uint64) ([]byte, error) {
-	if offset+length > uint64(len(m.Cell)) {
-		return nil, ErrOutOfMemory
+	if !m.inBounds(offset, length) {
+		return nil, ErrMemoryOutOfBounds
 	}
 
+	m.recordRead(offset, length)
 	return m.Cell[offset : offset+length], nil
 }
 
 // Store 将数据存储到指定偏移量的内存中，如果数据长度和偏移量的总和超出内存范围，则返回错误。
 func (m *Memory) Store(offset uint64, data []byte) error {
 	dLen := uint64(len(data))
-	if dLen+offset > uint64(len(m.Cell)) {
-		return ErrOutOfMemory
+	if !m.inBounds(offset, dLen) {
+		return ErrMemoryOutOfBounds
 	}
 
+	m.journalWrite(offset, dLen)
 	copy(m.Cell[offset:offset+dLen], data)
+	m.recordWrite(offset, dLen)
 	return nil
 }
 
 // StoreNBytes 将指定数量的字节从数据中存储到指定偏移量的内存中，如果偏移量和数量超出内存范围，返回错误。
 func (m *Memory) StoreNBytes(offset uint64, n uint64, data []byte) error {
-	if offset+n > uint64(len(m.Cell)) {
-		return ErrOutOfMemory
+	if !m.inBounds(offset, n) {
+		return ErrMemoryOutOfBounds
 	}
 
+	m.journalWrite(offset, n)
 	copy(m.Cell[offset:offset+n], data)
+	m.recordWrite(offset, n)
 	return nil
 }
 
 // Set 将单个字节存储到指定索引的内存中，如果索引超出内存范围，返回错误。
 func (m *Memory) Set(idx uint64, data byte) error {
-	if idx > uint64(len(m.Cell))-1 {
-		return ErrOutOfMemory
+	if !m.inBounds(idx, 1) {
+		return ErrMemoryOutOfBounds
 	}
 
+	m.journalWrite(idx, 1)
 	m.Cell[idx] = data
+	m.recordWrite(idx, 1)
 	return nil
 }
 
 // Copy 创建并返回从指定偏移量开始的指定长度的内存复制，如果范围超出内存大小，返回错误。
 func (m *Memory) Copy(offset uint64, length uint64) ([]byte, error) {
-	if offset+length > uint64(len(m.Cell)) {
-		return nil, ErrOutOfMemory
+	if !m.inBounds(offset, length) {
+		return nil, ErrMemoryOutOfBounds
 	}
 
 	ret := make([]byte, length, length)
@@ -94,6 +166,7 @@ func (m *Memory) Copy(offset uint64, length uint64) ([]byte, error) {
 	}
 
 	copy(ret, m.Cell[offset:offset+length])
+	m.recordRead(offset, length)
 	return ret, nil
 }
 
@@ -106,3 +179,59 @@ func (m *Memory) Size() int {
 func (m *Memory) All() []byte {
 	return m.Cell
 }
+
+// ResetAccess 清空已记录的读写区间
+func (m *Memory) ResetAccess() {
+	m.reads = m.reads[:0]
+	m.writes = m.writes[:0]
+}
+
+// AccessSet 返回自上次 ResetAccess 以来读写过的区间，相邻或重叠的区间会被合并
+func (m *Memory) AccessSet() (reads []Range, writes []Range) {
+	return mergeRanges(m.reads), mergeRanges(m.writes)
+}
+
+func (m *Memory) recordRead(offset uint64, length uint64) {
+	if length > 0 {
+		m.reads = append(m.reads, Range{offset, length})
+	}
+}
+
+func (m *Memory) recordWrite(offset uint64, length uint64) {
+	if length > 0 {
+		m.writes = append(m.writes, Range{offset, length})
+		if m.onWrite != nil {
+			m.onWrite(offset, m.Cell[offset:offset+length])
+		}
+	}
+}
+
+// mergeRanges 返回排序并合并后的区间副本
+func mergeRanges(ranges []Range) []Range {
+	if len(ranges) == 0 {
+		return nil
+	}
+	sorted := make([]Range, len(ranges))
+	copy(sorted, ranges)
+	sort.Sort(byOffset(sorted))
+
+	merged := []Range{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if r.Offset <= last.End() {
+			if r.End() > last.End() {
+				last.Length = r.End() - last.Offset
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// byOffset 按起始偏移量排序区间
+type byOffset []Range
+
+func (r byOffset) Len() int           { return len(r) }
+func (r byOffset) Less(i, j int) bool { return r[i].Offset < r[j].Offset }
+func (r byOffset) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
@@ -0,0 +1,59 @@
+package vm
+
+import (
+	"fmt"
+	"neochain/common"
+)
+
+// OpID 是操作码在 operations 中的下标
+type OpID uint16
+
+// Instruction 是预解码后的指令，参数已按类型取出，执行时不再做类型断言
+type Instruction struct {
+	Op     OpID
+	Uint64 [2]uint64 // ArgUint64 参数，按出现的顺序存放
+	Target int       // ArgTarget 参数
+	Bytes  []byte    // ArgBytes 参数
+}
+
+// Program 是预解码后的程序，可以被多次执行
+type Program struct {
+	Code         []common.Opcode // 原始操作码，供 Tracer 使用
+	Instructions []Instruction
+}
+
+// Decode 将操作码序列预解码为 Program：操作码名字转换为 OpID，参数转换为类型化的字段。
+// 操作码未知或参数个数、类型不匹配时返回 *VerifyError。
+func Decode(code []common.Opcode) (*Program, error) {
+	prog := &Program{
+		Code:         code,
+		Instructions: make([]Instruction, len(code)),
+	}
+	for pc, opcode := range code {
+		op, ok := opcodeTable[opcode.Name]
+		if !ok {
+			return nil, &VerifyError{pc, opcode.Name, ErrUnknownOpcode, "not in opcode table"}
+		}
+		if len(opcode.Args) != len(op.args) {
+			return nil, &VerifyError{pc, opcode.Name, ErrInvalidOperand, fmt.Sprintf("takes %d operands, got %d", len(op.args), len(opcode.Args))}
+		}
+		in := &prog.Instructions[pc]
+		in.Op = op.id
+		n := 0
+		for i, kind := range op.args {
+			if !operandMatches(opcode.Args[i], kind) {
+				return nil, &VerifyError{pc, opcode.Name, ErrInvalidOperand, fmt.Sprintf("operand %d is %T, want %v", i+1, opcode.Args[i], kind)}
+			}
+			switch kind {
+			case ArgUint64:
+				in.Uint64[n] = opcode.Args[i].(uint64)
+				n++
+			case ArgTarget:
+				in.Target = opcode.Args[i].(int)
+			case ArgBytes:
+				in.Bytes = opcode.Args[i].([]byte)
+			}
+		}
+	}
+	return prog, nil
+}
@@ -0,0 +1,67 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrOpcodeExists     = errors.New("opcode already registered")
+	ErrInvalidOpcodeDef = errors.New("invalid opcode definition")
+)
+
+// registryMu 串行化 RegisterOpcode 的调用
+var registryMu sync.Mutex
+
+// RegisterOpcode 注册一个扩展操作码，注册后汇编器、校验器与解释器都能识别它。
+//
+// name 须为大写的标识符；action 为处理函数，gas 为每次执行的静态价格，
+// 动态部分可在处理函数中通过 ctx.UseGas 扣除；stackIn 为执行前栈中至少需要的元素个数，
+// stackOut 为执行后压入的元素个数，校验器据此检查栈下溢；args 为立即数参数的类型，
+// 至多两个 ArgUint64、一个 ArgTarget 和一个 ArgBytes。名字已存在时返回 ErrOpcodeExists。
+//
+// 操作码表由所有 VM 共享且执行时不加锁，因此注册必须在任何 VM 开始执行之前完成，
+// 通常放在扩展包的 init 中。字节码按名字引用操作码，集群中所有节点须注册相同的扩展操作码，
+// 否则同一笔交易在不同节点上的执行结果会不同。
+func RegisterOpcode(name string, action OpAction, gas uint64, stackIn, stackOut int, args ...ArgKind) error {
+	if !isIdent(name) || name != strings.ToUpper(name) {
+		return fmt.Errorf("%w: name %q must be an upper-case identifier", ErrInvalidOpcodeDef, name)
+	}
+	if action == nil {
+		return fmt.Errorf("%w: %s has no handler", ErrInvalidOpcodeDef, name)
+	}
+	if stackIn < 0 || stackOut < 0 || stackIn > MaxStackDepth || stackOut > MaxStackDepth {
+		return fmt.Errorf("%w: %s stack effect %d -> %d out of range", ErrInvalidOpcodeDef, name, stackIn, stackOut)
+	}
+	op := operation{
+		name:   name,
+		action: action,
+		gas:    gas,
+		args:   append([]ArgKind(nil), args...),
+		pops:   stackIn,
+		pushes: stackOut,
+
+		extension: true,
+	}
+	if err := checkOperandLayout(&op); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidOpcodeDef, err)
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := opcodeTable[name]; ok {
+		return fmt.Errorf("%w: %s", ErrOpcodeExists, name)
+	}
+	if len(operations) > math.MaxUint16 {
+		return fmt.Errorf("%w: opcode table is full", ErrInvalidOpcodeDef)
+	}
+	// 扩展操作码的 OpID 按注册顺序追加在内置操作码之后。OpID 只在本节点内使用，
+	// 不进入字节码，因此各节点的注册顺序不必相同
+	op.id = OpID(len(operations))
+	opcodeTable[name] = op
+	operations = append(operations, op)
+	return nil
+}
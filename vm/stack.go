@@ -0,0 +1,55 @@
+package vm
+
+import (
+	"errors"
+	"math"
+)
+
+// MaxStackDepth 是每个调用帧的栈最多能容纳的元素个数
+const MaxStackDepth = 1024
+
+// ErrStackOverflow 在栈元素超过 MaxStackDepth 时返回
+var ErrStackOverflow = errors.New("stack overflow")
+
+func pop(ctx *Context, in *Instruction) error {
+	ctx.Pop()
+	return nil
+}
+
+// makeDup 返回 DUPn 的处理函数，把从栈顶数第 n 个元素（栈顶为第 1 个）复制到栈顶
+func makeDup(n int) OpAction {
+	return func(ctx *Context, in *Instruction) error {
+		if len(ctx.Stack) < n {
+			return ErrStackUnderflow
+		}
+		ctx.Push(ctx.Stack[len(ctx.Stack)-n])
+		return nil
+	}
+}
+
+// makeSwap 返回 SWAPn 的处理函数，交换栈顶与其下方第 n 个元素
+func makeSwap(n int) OpAction {
+	return func(ctx *Context, in *Instruction) error {
+		if len(ctx.Stack) < n+1 {
+			return ErrStackUnderflow
+		}
+		top := len(ctx.Stack) - 1
+		ctx.Stack[top], ctx.Stack[top-n] = ctx.Stack[top-n], ctx.Stack[top]
+		return nil
+	}
+}
+
+// jumpi 先弹出跳转目标，再弹出条件，条件非 0 时跳转。
+// 目标来自栈，无法静态校验，越界的目标在跳转时以 ErrInvalidJump 中止执行。
+func jumpi(ctx *Context, in *Instruction) error {
+	target := ctx.PopUint64()
+	cond := ctx.Pop()
+	if cond.IsZero() {
+		return nil
+	}
+	if target > math.MaxInt32 {
+		return ErrInvalidJump
+	}
+	ctx.SetPC(int(target))
+	return nil
+}
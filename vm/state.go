@@ -0,0 +1,139 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+)
+
+// StateSpace 是 common.RWSet 中状态读写集所在的键
+const StateSpace = "state"
+
+// State 是合约持久化状态的可插拔接口，以字符串为键
+type State interface {
+	// Get 返回 key 对应的值，key 不存在时返回 nil, nil
+	Get(key string) ([]byte, error)
+	// Put 写入 key 对应的值
+	Put(key string, value []byte) error
+}
+
+// StorageKey 返回合约 address 中 SLOAD/SSTORE 访问名为 name 的变量第 slot 个槽位时使用的键。
+// 直接执行代码的交易没有地址，其键不带地址前缀。
+func StorageKey(address string, name []byte, slot uint64) string {
+	return storageKey(address, name, Word{slot})
+}
+
+// storageKey 与 StorageKey 相同，槽位为栈上的元素，256 位的槽位以十进制写出
+func storageKey(address string, name []byte, slot Word) string {
+	if address == "" {
+		return fmt.Sprintf("%s[%s]", name, slot)
+	}
+	return fmt.Sprintf("%s/%s[%s]", address, name, slot)
+}
+
+// storagePrefix 返回合约 address 中名为 name 的变量所有槽位的键的公共前缀
+func storagePrefix(address string, name []byte) string {
+	if address == "" {
+		return fmt.Sprintf("%s[", name)
+	}
+	return fmt.Sprintf("%s/%s[", address, name)
+}
+
+// MemState 是基于 map 的 State 实现，适用于测试与工具
+type MemState map[string][]byte
+
+// NewMemState 创建一个空的 MemState
+func NewMemState() MemState {
+	return make(MemState)
+}
+
+func (s MemState) Get(key string) ([]byte, error) {
+	return s[key], nil
+}
+
+func (s MemState) Put(key string, value []byte) error {
+	s[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// OverlayState 是叠加在另一个 State 之上的写缓冲：
+// 读取先查自己的写缓冲再回落到 base，写入只进入缓冲，直到 Flush 才写入 base。
+// 它同时记录访问过的键，作为交易的状态读写集。
+type OverlayState struct {
+	base   State
+	dirty  map[string][]byte
+	reads  map[string]bool
+	writes map[string]bool
+}
+
+// NewOverlayState 创建一个叠加在 base 之上的 OverlayState
+func NewOverlayState(base State) *OverlayState {
+	return &OverlayState{
+		base:   base,
+		dirty:  make(map[string][]byte),
+		reads:  make(map[string]bool),
+		writes: make(map[string]bool),
+	}
+}
+
+func (s *OverlayState) Get(key string) ([]byte, error) {
+	s.reads[key] = true
+	if v, ok := s.dirty[key]; ok {
+		return v, nil
+	}
+	if s.base == nil {
+		return nil, nil
+	}
+	return s.base.Get(key)
+}
+
+func (s *OverlayState) Put(key string, value []byte) error {
+	s.writes[key] = true
+	s.dirty[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// Writes 返回缓冲中的写入，按键排序
+func (s *OverlayState) Writes() (keys []string, values [][]byte) {
+	keys = sortedKeys(s.dirty)
+	values = make([][]byte, len(keys))
+	for i, k := range keys {
+		values[i] = s.dirty[k]
+	}
+	return keys, values
+}
+
+// Flush 按键的顺序把缓冲中的写入写到 base 中，并清空缓冲
+func (s *OverlayState) Flush() error {
+	keys, values := s.Writes()
+	for i, k := range keys {
+		if err := s.base.Put(k, values[i]); err != nil {
+			return err
+		}
+	}
+	s.dirty = make(map[string][]byte)
+	return nil
+}
+
+// absorbReads 把子调用读过的键并入自己的读集
+func (s *OverlayState) absorbReads(child *OverlayState) {
+	for k := range child.reads {
+		s.reads[k] = true
+	}
+}
+
+// AccessSet 返回读过和写过的键，按字典序排列
+func (s *OverlayState) AccessSet() (reads []string, writes []string) {
+	return sortedKeys(s.reads), sortedKeys(s.writes)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,77 @@
+package vm
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"neochain/common"
+	"sync"
+)
+
+// Tracer 在执行过程中接收 VM 的事件，用于调试与诊断。
+// 回调在执行线程中同步调用，传入的 Context 与数据只在回调期间有效。
+type Tracer interface {
+	// OnStep 在每条指令扣除 gas 并执行之前调用，ctx.PC 即为该指令的下标
+	OnStep(ctx *Context, op common.Opcode, cost uint64)
+	// OnMemoryWrite 在内存 [offset, offset+len(data)) 被写入之后调用
+	OnMemoryWrite(offset uint64, data []byte)
+	// OnError 在执行因错误中止时调用，ctx.PC 为出错指令的下标
+	OnError(ctx *Context, err error)
+	// OnExit 在执行结束时调用，无论是否出错
+	OnExit(result *ExecutionResult, err error)
+}
+
+// JSONTracer 将每个事件写为一行 JSON
+type JSONTracer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONTracer 创建一个写入 w 的 JSONTracer
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{enc: json.NewEncoder(w)}
+}
+
+type traceEvent struct {
+	Event   string        `json:"event"`
+	PC      *int          `json:"pc,omitempty"`
+	Op      string        `json:"op,omitempty"`
+	Args    []interface{} `json:"args,omitempty"`
+	Gas     *uint64       `json:"gas,omitempty"`
+	Cost    *uint64       `json:"cost,omitempty"`
+	Stack   []Word        `json:"stack,omitempty"`
+	Offset  *uint64       `json:"offset,omitempty"`
+	Data    string        `json:"data,omitempty"`
+	GasUsed *uint64       `json:"gasUsed,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+func (t *JSONTracer) OnStep(ctx *Context, op common.Opcode, cost uint64) {
+	pc, gas := ctx.PC, ctx.Gas
+	stack := make([]Word, len(ctx.Stack))
+	copy(stack, ctx.Stack)
+	t.write(traceEvent{Event: "step", PC: &pc, Op: op.Name, Args: op.Args, Gas: &gas, Cost: &cost, Stack: stack})
+}
+
+func (t *JSONTracer) OnMemoryWrite(offset uint64, data []byte) {
+	t.write(traceEvent{Event: "memory", Offset: &offset, Data: hex.EncodeToString(data)})
+}
+
+func (t *JSONTracer) OnError(ctx *Context, err error) {
+	pc := ctx.PC
+	t.write(traceEvent{Event: "error", PC: &pc, Error: err.Error()})
+}
+
+func (t *JSONTracer) OnExit(result *ExecutionResult, err error) {
+	ev := traceEvent{Event: "exit", GasUsed: &result.GasUsed}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	t.write(ev)
+}
+
+func (t *JSONTracer) write(ev traceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_ = t.enc.Encode(ev)
+}
@@ -0,0 +1,127 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"neochain/common"
+)
+
+var (
+	ErrUnknownOpcode  = errors.New("unknown opcode")
+	ErrInvalidOperand = errors.New("invalid operand")
+	ErrInvalidJump    = errors.New("jump target out of range")
+	ErrStackUnderflow = errors.New("stack underflow")
+)
+
+// VerifyError 描述程序中未通过校验的指令，可用 errors.Is 判断具体原因
+type VerifyError struct {
+	PC     int
+	Opcode string
+	Err    error
+	Detail string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("verify: pc %d (%s): %v: %s", e.PC, e.Opcode, e.Err, e.Detail)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// Verify 在执行前静态校验程序：操作码必须已知，参数个数与类型必须匹配，
+// 跳转目标必须落在 [0, len(code)] 内，任何执行路径上都不会出现栈下溢，
+// 也没有一定会栈溢出的指令。
+//
+// JUMPI 的目标来自栈，无法静态确定，校验只沿顺序执行与立即数跳转的路径进行；
+// 动态跳转目标的范围与其后的栈下溢在执行时检查。
+//
+// 栈深度通过抽象解释求得：对每条指令记录所有可达路径中最小的栈深度，
+// 最小深度只会变小且不小于 0，因此带循环的程序也一定会收敛。
+// 指令执行后的最小深度超过 MaxStackDepth 时，到达这里的每条路径都会栈溢出，程序被拒绝；
+// 只在部分路径（如循环中不断压栈）上溢出的程序仍然通过校验，在执行时失败。
+func Verify(code []common.Opcode) error {
+	for pc, opcode := range code {
+		op, ok := opcodeTable[opcode.Name]
+		if !ok {
+			return &VerifyError{pc, opcode.Name, ErrUnknownOpcode, "not in opcode table"}
+		}
+		if len(opcode.Args) != len(op.args) {
+			return &VerifyError{pc, opcode.Name, ErrInvalidOperand, fmt.Sprintf("takes %d operands, got %d", len(op.args), len(opcode.Args))}
+		}
+		for i, kind := range op.args {
+			if !operandMatches(opcode.Args[i], kind) {
+				return &VerifyError{pc, opcode.Name, ErrInvalidOperand, fmt.Sprintf("operand %d is %T, want %v", i+1, opcode.Args[i], kind)}
+			}
+			if kind == ArgTarget {
+				if target := opcode.Args[i].(int); target < 0 || target > len(code) {
+					return &VerifyError{pc, opcode.Name, ErrInvalidJump, fmt.Sprintf("target %d, code length %d", target, len(code))}
+				}
+			}
+		}
+	}
+
+	// minDepth[pc] 为到达 pc 时的最小栈深度，-1 表示尚不可达
+	minDepth := make([]int, len(code)+1)
+	for i := range minDepth {
+		minDepth[i] = -1
+	}
+	visit := func(pc int, depth int, work *[]int) {
+		if minDepth[pc] == -1 || depth < minDepth[pc] {
+			minDepth[pc] = depth
+			*work = append(*work, pc)
+		}
+	}
+	work := make([]int, 0)
+	visit(0, 0, &work)
+	for len(work) > 0 {
+		pc := work[len(work)-1]
+		work = work[:len(work)-1]
+		if pc == len(code) {
+			continue
+		}
+		opcode := code[pc]
+		op := opcodeTable[opcode.Name]
+		depth := minDepth[pc]
+		if depth < op.pops {
+			return &VerifyError{pc, opcode.Name, ErrStackUnderflow, fmt.Sprintf("needs %d stack items, has %d", op.pops, depth)}
+		}
+		next := depth - op.pops + op.stackOut(opcode.Args)
+		if next > MaxStackDepth {
+			return &VerifyError{pc, opcode.Name, ErrStackOverflow, fmt.Sprintf("leaves at least %d stack items, limit %d", next, MaxStackDepth)}
+		}
+		for _, succ := range successors(pc, opcode, &op) {
+			visit(succ, next, &work)
+		}
+	}
+	return nil
+}
+
+// successors 返回指令执行后可能的下一条指令下标
+func successors(pc int, opcode common.Opcode, op *operation) []int {
+	succ := make([]int, 0, 2)
+	if !op.noNext {
+		succ = append(succ, pc+1)
+	}
+	for i, kind := range op.args {
+		if kind == ArgTarget {
+			succ = append(succ, opcode.Args[i].(int))
+		}
+	}
+	return succ
+}
+
+func operandMatches(arg interface{}, kind ArgKind) bool {
+	switch kind {
+	case ArgUint64:
+		_, ok := arg.(uint64)
+		return ok
+	case ArgTarget:
+		_, ok := arg.(int)
+		return ok
+	case ArgBytes:
+		_, ok := arg.([]byte)
+		return ok
+	}
+	return false
+}
@@ -1,168 +1,485 @@
 package vm
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"math"
-	"math/rand"
 	"neochain/common"
 	"neochain/utils"
 )
 
-type OpAction = func(*Context, []interface{}) error
+// OpAction 是操作码的处理函数，in 为预解码后的当前指令
+type OpAction = func(ctx *Context, in *Instruction) error
+
+// ErrExecutionReverted 由 REVERT 操作码返回，交易的所有写入都会被撤销
+var ErrExecutionReverted = errors.New("execution reverted")
+
+// ArgKind 描述操作码参数的类型
+type ArgKind int
+
+const (
+	ArgUint64 ArgKind = iota // uint64 立即数
+	ArgTarget                // int 跳转目标，即指令下标
+	ArgBytes                 // []byte 立即数据
+)
+
+func (k ArgKind) String() string {
+	switch k {
+	case ArgUint64:
+		return "uint64"
+	case ArgTarget:
+		return "target"
+	case ArgBytes:
+		return "bytes"
+	}
+	return "unknown"
+}
+
+// operation 描述一个操作码的处理函数、gas 价格、参数类型及栈效果
+type operation struct {
+	id        OpID
+	name      string
+	action    OpAction
+	gas       uint64
+	args      []ArgKind
+	pops      int  // 执行前栈中至少需要的元素个数
+	pushes    int  // 执行后栈深度为 原深度 - pops + pushes
+	noNext    bool // 执行后不会顺序执行下一条指令，如无条件跳转
+	extension bool // 由 RegisterOpcode 注册，静态分析无法得知其访问的状态
+
+	dynamicPushes func(args []interface{}) int // 非空时取代 pushes，用于压栈个数由参数决定的操作码
+}
+
+// MemorySpace 是 common.RWSet 中内存读写集所在的键
+const MemorySpace = "memory"
+
+// opcodeTable 是所有 VM 共享的操作码表，按名字索引；
+// operations 与之内容相同，按 OpID 索引，供解释器分派。
+// 除 RegisterOpcode 外，两者在加载后只读
+var (
+	opcodeTable map[string]operation
+	operations  []operation
+)
+
+// 处理函数 call 经 Decode 间接引用 opcodeTable，因此操作码表在 init 中加载
+func init() {
+	opcodeTable, operations = loadOpcodes()
+}
+
+// ExecutionResult 记录一次交易执行的结果
+type ExecutionResult struct {
+	GasUsed       uint64   // 实际消耗的 gas
+	ReadSet       []Range  // 读过的内存区间，已排序合并
+	WriteSet      []Range  // 写过的内存区间，已排序合并
+	StateReadSet  []string // 读过的状态键，按字典序排列
+	StateWriteSet []string // 写过的状态键，按字典序排列
+
+	ReturnData      []byte       // 顶层调用通过 RETURN 返回的数据
+	ContractAddress string       // 部署交易创建的合约地址
+	Logs            []common.Log // 执行成功时产生的事件日志，按产生的顺序排列
+
+	MemorySize     uint64 // 执行结束时（撤销写入之前）内存的字节数。每个交易从初始内存开始且内存只增不减，因此即本交易的内存峰值
+	MemoryExpanded uint64 // 本交易通过 MALLOC 扩展的字节数，不含被调用合约的内存
+	Steps          uint64 // 执行的指令条数，包括被调用合约中的指令
+}
+
+// RWSet 将读写集转换为 common.RWSet，内存区间记录在 "memory" 下，格式为 "offset:length"，
+// 状态键记录在 "state" 下
+func (r *ExecutionResult) RWSet() common.RWSet {
+	rwSet := common.RWSet{
+		RSet: make(map[string][]string),
+		WSet: make(map[string][]string),
+	}
+	for _, rg := range r.ReadSet {
+		rwSet.RSet[MemorySpace] = append(rwSet.RSet[MemorySpace], rg.String())
+	}
+	for _, rg := range r.WriteSet {
+		rwSet.WSet[MemorySpace] = append(rwSet.WSet[MemorySpace], rg.String())
+	}
+	if len(r.StateReadSet) > 0 {
+		rwSet.RSet[StateSpace] = r.StateReadSet
+	}
+	if len(r.StateWriteSet) > 0 {
+		rwSet.WSet[StateSpace] = r.StateWriteSet
+	}
+	return rwSet
+}
 
 // VM 模拟一个简单的交易执行引擎
 type VM struct {
-	opcodeMap map[string]OpAction
-	Context   *Context
+	Context *Context
+	State   State  // 合约的持久化状态，只有执行成功的交易才会写入
+	Tracer  Tracer // 可选的执行追踪器，为 nil 时不追踪
+
+	WordSize      WordSize     // 栈元素的位宽，默认为 Word64
+	CheckOverflow bool         // 为 true 时算术溢出返回 ErrArithmeticOverflow，否则回绕
+	MaxMemory     uint64       // 内存大小的上限，默认为 DefaultMaxMemory，为 0 时不限制
+	Block         BlockContext // 环境操作码读取的区块与交易信息，由调用方在每次执行前设置
+
+	// 以下字段只在一次执行期间有效，由 ExecuteTransactionContext 设置
+	steps    uint64          // 已执行的指令条数
+	maxSteps uint64          // 指令条数上限，为 0 时不限制
+	limited  bool            // 是否需要检查指令条数或取消信号
+	ctx      context.Context // 取消信号的来源
+	done     <-chan struct{} // ctx.Done()，为 nil 时不会被取消
+
+	cell []byte // 每个交易开始时的内存内容
 }
 
-// NewVM 创建并初始化一个新的执行引擎
+// NewVM 创建并初始化一个新的执行引擎，状态为空的 MemState。
+// cell 为临时内存的初始内容，每个交易都从这份内容开始，看不到之前交易写入的内存
 func NewVM(cell []byte) *VM {
 	e := &VM{
 		Context:   NewContext(cell),
-		opcodeMap: make(map[string]OpAction),
+		State:     NewMemState(),
+		WordSize:  Word64,
+		MaxMemory: DefaultMaxMemory,
+		cell:      append([]byte{}, cell...),
 	}
-	e.loadOpcodes()
 	return e
 }
 
-// loadOpcodes 加载所有操作码及其对应的处理函数
-func (e *VM) loadOpcodes() {
-	e.opcodeMap["LOAD"] = load
-	e.opcodeMap["STOREI"] = storei
-	e.opcodeMap["STORE"] = store
-	e.opcodeMap["MALLOC"] = malloc
-	e.opcodeMap["ADD"] = add
-	e.opcodeMap["SUB"] = sub
-	e.opcodeMap["MUL"] = mul
-	e.opcodeMap["DIV"] = div
-	e.opcodeMap["CMP"] = cmp
-	e.opcodeMap["JMP"] = jmp
-	e.opcodeMap["JEQ"] = jeq
-	e.opcodeMap["PUSH"] = push
-	e.opcodeMap["DUP"] = dup
-	e.opcodeMap["SLEEP"] = sleep
-}
-
-// ExecuteTransaction 执行给定的交易
-func (e *VM) ExecuteTransaction(t *common.Transaction) error {
+// NewVMWithState 创建一个以 state 为持久化状态、内存为空的执行引擎
+func NewVMWithState(state State) *VM {
+	e := NewVM(nil)
+	e.State = state
+	return e
+}
+
+// loadOpcodes 加载所有操作码及其对应的处理函数、gas 价格和参数类型，
+// 按名字的字典序分配 OpID
+func loadOpcodes() (map[string]operation, []operation) {
+	table := map[string]operation{
+		"LOAD":   {action: load, gas: GasMemory, args: []ArgKind{ArgUint64, ArgUint64}, dynamicPushes: loadPushes},
+		"STOREI": {action: storei, gas: GasMemory, args: []ArgKind{ArgUint64, ArgBytes}},
+		"STORE":  {action: store, gas: GasMemory, args: []ArgKind{ArgUint64}, pops: 1, pushes: 1},
+		"LOADW":  {action: loadw, gas: GasMemory, args: []ArgKind{ArgUint64}, pushes: 1},
+		"MALLOC": {action: malloc, gas: GasAlloc, args: []ArgKind{ArgUint64}, pushes: 1},
+		"ADD":    {action: add, gas: GasFastest, pops: 2, pushes: 1},
+		"SUB":    {action: sub, gas: GasFastest, pops: 2, pushes: 1},
+		"MUL":    {action: mul, gas: GasFast, pops: 2, pushes: 1},
+		"DIV":    {action: div, gas: GasFast, pops: 2, pushes: 1},
+		"MOD":    {action: mod, gas: GasFast, pops: 2, pushes: 1},
+		"SDIV":   {action: sdiv, gas: GasFast, pops: 2, pushes: 1},
+		"SMOD":   {action: smod, gas: GasFast, pops: 2, pushes: 1},
+		"EXP":    {action: exp, gas: GasExp, pops: 2, pushes: 1},
+		"AND":    {action: and, gas: GasFastest, pops: 2, pushes: 1},
+		"OR":     {action: or, gas: GasFastest, pops: 2, pushes: 1},
+		"XOR":    {action: xor, gas: GasFastest, pops: 2, pushes: 1},
+		"NOT":    {action: not, gas: GasFastest, pops: 1, pushes: 1},
+		"SHL":    {action: shl, gas: GasFastest, pops: 2, pushes: 1},
+		"SHR":    {action: shr, gas: GasFastest, pops: 2, pushes: 1},
+		"SAR":    {action: sar, gas: GasFastest, pops: 2, pushes: 1},
+		"CMP":    {action: cmp, gas: GasFastest, pops: 2, pushes: 1},
+		"LT":     {action: lt, gas: GasFastest, pops: 2, pushes: 1},
+		"GT":     {action: gt, gas: GasFastest, pops: 2, pushes: 1},
+		"SLT":    {action: slt, gas: GasFastest, pops: 2, pushes: 1},
+		"SGT":    {action: sgt, gas: GasFastest, pops: 2, pushes: 1},
+		"EQ":     {action: eq, gas: GasFastest, pops: 2, pushes: 1},
+		"ISZERO": {action: isZero, gas: GasFastest, pops: 1, pushes: 1},
+		"JMP":    {action: jmp, gas: GasMid, args: []ArgKind{ArgTarget}, noNext: true},
+		"JEQ":    {action: jeq, gas: GasMid, args: []ArgKind{ArgTarget, ArgUint64}, pops: 1, pushes: 1},
+		"JUMPI":  {action: jumpi, gas: GasMid, pops: 2},
+		"PUSH":   {action: push, gas: GasQuick, args: []ArgKind{ArgUint64}, pushes: 1},
+		"PUSHW":  {action: pushw, gas: GasQuick, args: []ArgKind{ArgBytes}, pushes: 1},
+		"POP":    {action: pop, gas: GasQuick, pops: 1},
+		"DUP":    {action: dup, gas: GasQuick, pops: 1, pushes: 2},
+		"WORK":   {action: work, gas: GasWork, args: []ArgKind{ArgUint64}},
+		"REVERT": {action: revert, gas: GasQuick, noNext: true},
+		"SLOAD":  {action: sload, gas: GasSLoad, args: []ArgKind{ArgBytes}, pops: 1, pushes: 1},
+		"SSTORE": {action: sstore, gas: GasSStore, args: []ArgKind{ArgBytes}, pops: 2},
+		"CALL":   {action: call, gas: GasCall, args: []ArgKind{ArgBytes}, pops: 2, pushes: 1},
+		"RETURN": {action: ret, gas: GasQuick, pops: 2, noNext: true},
+		"HASH":   {action: hash, gas: GasHash, pops: 2, pushes: 1},
+
+		"RETURNDATASIZE": {action: returnDataSize, gas: GasQuick, pushes: 1},
+		"RETURNDATACOPY": {action: returnDataCopy, gas: GasMemory, pops: 1},
+		"CALLDATALOAD":   {action: callDataLoad, gas: GasFastest, pops: 1, pushes: 1},
+		"CALLDATASIZE":   {action: callDataSize, gas: GasQuick, pushes: 1},
+		"CALLDATACOPY":   {action: callDataCopy, gas: GasMemory, pops: 3},
+
+		"HEIGHT":    {action: height, gas: GasQuick, pushes: 1},
+		"TIMESTAMP": {action: timestamp, gas: GasQuick, pushes: 1},
+		"PREVHASH":  {action: prevHash, gas: GasQuick, pushes: 1},
+		"TXHASH":    {action: txHash, gas: GasQuick, pushes: 1},
+		"CALLER":    {action: caller, gas: GasQuick, pushes: 1},
+
+		"LOG0": {action: makeLog(0), gas: GasLog, pops: 2},
+		"LOG1": {action: makeLog(1), gas: GasLog + GasLogTopic, pops: 3},
+		"LOG2": {action: makeLog(2), gas: GasLog + 2*GasLogTopic, pops: 4},
+		"LOG3": {action: makeLog(3), gas: GasLog + 3*GasLogTopic, pops: 5},
+		"LOG4": {action: makeLog(4), gas: GasLog + 4*GasLogTopic, pops: 6},
+	}
+	// DUP1 与 DUP 相同；SWAPn 交换栈顶与其下方第 n 个元素
+	for n := 1; n <= 16; n++ {
+		table[fmt.Sprintf("DUP%d", n)] = operation{action: makeDup(n), gas: GasQuick, pops: n, pushes: n + 1}
+		table[fmt.Sprintf("SWAP%d", n)] = operation{action: makeSwap(n), gas: GasQuick, pops: n + 1, pushes: n + 1}
+	}
+
+	names := sortedKeys(table)
+	ops := make([]operation, len(names))
+	for i, name := range names {
+		op := table[name]
+		op.id = OpID(i)
+		op.name = name
+		if err := checkOperandLayout(&op); err != nil {
+			panic(err)
+		}
+		table[name] = op
+		ops[i] = op
+	}
+	return table, ops
+}
+
+// checkOperandLayout 确认操作码的参数能放入 Instruction：至多两个 uint64、一个跳转目标和一个 bytes
+func checkOperandLayout(op *operation) error {
+	counts := make(map[ArgKind]int)
+	for _, kind := range op.args {
+		if kind != ArgUint64 && kind != ArgTarget && kind != ArgBytes {
+			return fmt.Errorf("opcode %s: unknown operand kind %d", op.name, kind)
+		}
+		counts[kind]++
+	}
+	if counts[ArgUint64] > 2 || counts[ArgTarget] > 1 || counts[ArgBytes] > 1 {
+		return fmt.Errorf("opcode %s: operands %v do not fit in Instruction", op.name, op.args)
+	}
+	return nil
+}
+
+// stackOut 返回指令执行后压入栈的元素个数
+func (op *operation) stackOut(args []interface{}) int {
+	if op.dynamicPushes != nil {
+		return op.dynamicPushes(args)
+	}
+	return op.pushes
+}
+
+// ExecuteTransaction 执行给定的交易，每条指令执行前按价格扣除 gas，
+// gas 不足时中止执行并返回 *OutOfGasError。
+// 根据交易类型，执行交易自带的代码、部署合约或调用已部署的合约。
+// 执行出错（包括处理函数 panic）时，交易对内存与状态的所有写入都会被撤销；
+// 执行成功时，状态写入按键的顺序写入 e.State。
+// 需要取消或限制执行时间时使用 ExecuteTransactionContext。
+func (e *VM) ExecuteTransaction(t *common.Transaction) (*ExecutionResult, error) {
+	return e.ExecuteTransactionContext(context.Background(), t, Limits{})
+}
+
+// execute 执行交易，限制由调用方事先设置在 e 上
+func (e *VM) execute(t *common.Transaction) (result *ExecutionResult, err error) {
+	e.steps = 0
 	e.Context.SetPC(0)
-	for e.Context.PC < len(t.Code) {
-		if e.Context.PC >= len(t.Code) {
-			return errors.New("program counter out of bounds")
-		}
-		opcode := t.Code[e.Context.PC]
-		//fmt.Printf("pc   : %x\n", e.Context.PC)
-		//fmt.Printf("cmd  : %s(%s)\n", opcode.Name, opcode.Args)
-		//fmt.Printf("mem  : %x\n", utils.LongBytesToInt(e.Context.Memory.Cell[:32]))
-		//fmt.Printf("stack: %x\n", e.Context.Stack)
-		if op, exists := e.opcodeMap[opcode.Name]; exists {
-			err := op(e.Context, opcode.Args)
+	e.Context.jumped = false
+	e.Context.halted = false
+	e.Context.Stack = e.Context.Stack[:0]
+	e.Context.Gas = t.GasLimit
+	e.Context.Address = ""
+	e.Context.ReturnData = nil
+	e.Context.Logs = nil
+	e.Context.CallData = t.Data
+	e.Context.Caller = e.Block.Caller
+	e.Context.depth = 0
+	e.Context.vm = e
+	e.Context.wordSize = e.WordSize
+	e.Context.checked = e.CheckOverflow
+	e.Context.Memory = NewMemory(e.cell)
+	e.Context.Memory.Limit = e.MaxMemory
+	e.Context.Memory.onWrite = nil
+	if e.Tracer != nil {
+		e.Context.Memory.onWrite = e.Tracer.OnMemoryWrite
+	}
+	overlay := NewOverlayState(e.State)
+	e.Context.State = overlay
+	result = &ExecutionResult{}
+	initialSize := uint64(e.Context.Memory.Size())
+	defer func() {
+		if err == nil {
+			err = overlay.Flush()
+		}
+		result.MemorySize = uint64(e.Context.Memory.Size())
+		result.MemoryExpanded = result.MemorySize - initialSize
+		if err != nil {
+			// 内存在每个交易开始时由 e.cell 重建，失败时直接恢复为初始内容，不必为每次写入记录日志
+			e.Context.Memory.Cell = NewMemory(e.cell).Cell
+		} else {
+			result.ReturnData = e.Context.ReturnData
+			result.Logs = e.Context.Logs
+		}
+		result.StateReadSet, result.StateWriteSet = overlay.AccessSet()
+		result.GasUsed = t.GasLimit - e.Context.Gas
+		result.Steps = e.steps
+		result.ReadSet, result.WriteSet = e.Context.Memory.AccessSet()
+		if e.Tracer != nil {
 			if err != nil {
-				return err
+				e.Tracer.OnError(e.Context, err)
 			}
+			e.Tracer.OnExit(result, err)
+		}
+	}()
+
+	switch t.Type {
+	case common.TxExec:
+		prog, err := Decode(t.Code)
+		if err != nil {
+			return result, err
+		}
+		return result, e.run(e.Context, prog)
+	case common.TxDeploy:
+		result.ContractAddress, err = deploy(e.Context, t.Code)
+		return result, err
+	case common.TxInvoke:
+		prog, err := loadContract(e.Context.State, t.To)
+		if err != nil {
+			return result, err
+		}
+		e.Context.Address = t.To
+		return result, e.run(e.Context, prog)
+	}
+	return result, fmt.Errorf("unknown transaction type %d", t.Type)
+}
+
+// run 在 ctx 中从 ctx.PC 开始执行 prog，直到执行完最后一条指令、遇到 RETURN 或出错。
+// 跳转到 len(prog.Instructions) 等同于正常结束。处理函数的 panic 会被转换为错误。
+// 指令按 OpID 在 operations 中直接分派，不再按名字查表。
+func (e *VM) run(ctx *Context, prog *Program) (err error) {
+	limit := ctx.Gas
+	ctx.gasLimit = limit
+	defer func() {
+		if r := recover(); r != nil {
+			if rErr, ok := r.(error); ok {
+				err = fmt.Errorf("pc %d: %w", ctx.PC, rErr)
+			} else {
+				err = fmt.Errorf("pc %d: panic: %v", ctx.PC, r)
+			}
+		}
+	}()
+	code := prog.Instructions
+	for !ctx.halted && ctx.PC != len(code) {
+		if ctx.PC < 0 || ctx.PC > len(code) {
+			return fmt.Errorf("pc %d: %w", ctx.PC, ErrInvalidJump)
+		}
+		in := &code[ctx.PC]
+		op := &operations[in.Op]
+		e.steps++
+		if e.limited {
+			if err := e.checkLimits(); err != nil {
+				return fmt.Errorf("pc %d: %w", ctx.PC, err)
+			}
+		}
+		if e.Tracer != nil {
+			e.Tracer.OnStep(ctx, prog.Code[ctx.PC], op.gas)
+		}
+		if ctx.Gas < op.gas {
+			ctx.Gas = 0
+			return &OutOfGasError{PC: ctx.PC, Opcode: op.name, Limit: limit}
+		}
+		ctx.Gas -= op.gas
+		if err := op.action(ctx, in); err != nil {
+			return err
+		}
+		if ctx.jumped {
+			ctx.jumped = false
 		} else {
-			return errors.New("unknown opcode")
+			ctx.IncrementPC()
 		}
-		e.Context.IncrementPC()
 	}
 	return nil
 }
 
 // 示例操作码函数
-func load(ctx *Context, args []interface{}) error {
-	offset := args[0].(uint64)
-	length := args[1].(uint64)
+func load(ctx *Context, in *Instruction) error {
+	offset := in.Uint64[0]
+	length := in.Uint64[1]
 	data, err := ctx.Memory.Map(offset, length)
 	if err != nil {
 		return err
 	}
-	datas := make([]uint64, 0)
-	for i := 0; i < int(length); i += 8 {
-		var endI int
-		if uint64(i+8) > length {
-			endI = int(length)
-		} else {
-			endI = i + 8
+	for i := uint64(0); i < length; i += 8 {
+		end := i + 8
+		if end > length {
+			end = length
 		}
-		datas = append(datas, utils.BytesToInt(data[i:endI]))
-	}
-	for _, d := range datas {
-		ctx.Push(d)
+		ctx.Push(common.NewWord(utils.BytesToInt(data[i:end])))
 	}
 	return nil
 }
 
-func storei(ctx *Context, args []interface{}) error {
-	offset := args[0].(uint64)
-	return ctx.Memory.Store(offset, args[1].([]byte))
-}
-
-func store(ctx *Context, args []interface{}) error {
-	offset := args[0].(uint64)
-	value := utils.UintToBytes(ctx.Peek())
-	return ctx.Memory.Store(offset, value)
-}
-
-func malloc(ctx *Context, args []interface{}) error {
-	size := args[0].(uint64)
-	offset := uint64(ctx.Memory.Size())
-	ctx.Memory.Malloc(offset, size)
-	ctx.Push(offset)
-	return nil
+// loadPushes LOAD 每 8 字节压入一个元素，不足 8 字节的部分也占一个，与栈的位宽无关。
+// 结果最多为 MaxStackDepth+1：再多的元素也只会让执行以栈溢出失败
+func loadPushes(args []interface{}) int {
+	length := args[1].(uint64)
+	n := length / 8
+	if length%8 != 0 {
+		n++
+	}
+	if n > MaxStackDepth+1 {
+		n = MaxStackDepth + 1
+	}
+	return int(n)
 }
 
-func add(ctx *Context, args []interface{}) error {
-	a := ctx.Pop()
-	b := ctx.Pop()
-	ctx.Push(a + b)
-	return nil
+func storei(ctx *Context, in *Instruction) error {
+	offset := in.Uint64[0]
+	return storeWords(ctx, offset, in.Bytes, "STOREI")
 }
 
-func sub(ctx *Context, args []interface{}) error {
-	a := ctx.Pop()
-	b := ctx.Pop()
-	ctx.Push(b - a)
-	return nil
+// store 将栈顶元素写入内存，64 位模式写入 8 字节，256 位模式写入 32 字节
+func store(ctx *Context, in *Instruction) error {
+	offset := in.Uint64[0]
+	value := ctx.wordBytes(ctx.Peek())
+	return storeWords(ctx, offset, value, "STORE")
 }
 
-func mul(ctx *Context, args []interface{}) error {
-	a := ctx.Pop()
-	b := ctx.Pop()
-	ctx.Push(a * b)
-	return nil
+// storeWords 检查范围后按写入的字数扣费，再将 data 写入内存
+func storeWords(ctx *Context, offset uint64, data []byte, name string) error {
+	length := uint64(len(data))
+	if !ctx.Memory.inBounds(offset, length) {
+		return ErrMemoryOutOfBounds
+	}
+	if err := ctx.useDynamicGas(GasCopyWord*dataWords(length), name); err != nil {
+		return err
+	}
+	return ctx.Memory.Store(offset, data)
 }
 
-func div(ctx *Context, args []interface{}) error {
-	a := ctx.Pop()
-	b := ctx.Pop()
-	if a == 0 {
-		return errors.New("division by zero")
+// loadw 将内存中的一个完整元素压入栈，64 位模式读取 8 字节，256 位模式读取 32 字节
+func loadw(ctx *Context, in *Instruction) error {
+	offset := in.Uint64[0]
+	data, err := ctx.Memory.Map(offset, uint64(ctx.wordSize.bits()/8))
+	if err != nil {
+		return err
 	}
-	ctx.Push(b / a)
+	ctx.Push(ctx.wordFromBytes(data))
 	return nil
 }
 
-func cmp(ctx *Context, args []interface{}) error {
-	a := ctx.Pop()
-	b := ctx.Pop()
-	if a < b {
-		ctx.Push(1)
-	} else {
-		ctx.Push(0)
+// malloc 在内存末尾分配 size 字节并压入其起始偏移量。
+// 先检查内存上限，超过时返回 ErrOutOfMemory；再按扩展前后的大小扣除扩展费用
+func malloc(ctx *Context, in *Instruction) error {
+	size := in.Uint64[0]
+	offset := uint64(ctx.Memory.Size())
+	if err := ctx.Memory.CheckGrow(offset, size); err != nil {
+		return err
+	}
+	if err := ctx.useDynamicGas(memoryExpansionGas(offset, offset+size), "MALLOC"); err != nil {
+		return err
 	}
+	if _, err := ctx.Memory.Malloc(offset, size); err != nil {
+		return err
+	}
+	ctx.Push(common.NewWord(offset))
 	return nil
 }
 
-func jmp(ctx *Context, args []interface{}) error {
-	target := ctx.Peek()
-	ctx.SetPC(int(target))
+func jmp(ctx *Context, in *Instruction) error {
+	target := in.Target
+	ctx.SetPC(target)
 	return nil
 }
 
-func jeq(ctx *Context, args []interface{}) error {
-	target := args[0].(int)
-	a := args[1].(uint64)
+func jeq(ctx *Context, in *Instruction) error {
+	target := in.Target
+	a := common.NewWord(in.Uint64[0])
 	b := ctx.Peek()
 
 	if a == b {
@@ -172,21 +489,74 @@ func jeq(ctx *Context, args []interface{}) error {
 	return nil
 }
 
-func push(ctx *Context, args []interface{}) error {
-	value := args[0].(uint64)
-	ctx.Push(value)
+func push(ctx *Context, in *Instruction) error {
+	value := in.Uint64[0]
+	ctx.Push(common.NewWord(value))
 	return nil
 }
 
-func dup(ctx *Context, args []interface{}) error {
+// pushw 将最多 32 字节的大端序立即数压入栈，64 位模式下只保留低 64 位
+func pushw(ctx *Context, in *Instruction) error {
+	data := in.Bytes
+	if len(data) > 32 {
+		return fmt.Errorf("%w: PUSHW takes at most 32 bytes, got %d", ErrInvalidOperand, len(data))
+	}
+	ctx.Push(ctx.mask(utils.BytesToWord(data)))
+	return nil
+}
+
+func dup(ctx *Context, in *Instruction) error {
 	top := ctx.Peek()
 	ctx.Push(top)
 	return nil
 }
 
-func sleep(ctx *Context, args []interface{}) error {
-	for i := 0; i < 300000; i++ {
-		_ = math.Atan(math.Sqrt(float64(rand.Int63())))
+func sload(ctx *Context, in *Instruction) error {
+	slot := ctx.Pop()
+	value, err := ctx.State.Get(storageKey(ctx.Address, in.Bytes, slot))
+	if err != nil {
+		return err
+	}
+	ctx.Push(ctx.wordFromBytes(value))
+	return nil
+}
+
+func sstore(ctx *Context, in *Instruction) error {
+	slot := ctx.Pop()
+	value := ctx.Pop()
+	return ctx.State.Put(storageKey(ctx.Address, in.Bytes, slot), ctx.wordBytes(value))
+}
+
+func revert(ctx *Context, in *Instruction) error {
+	return ErrExecutionReverted
+}
+
+// work 执行参数给出次数的合成计算，用于模拟执行开销。
+// 迭代次数在执行前按 WorkPerGas 计价，计算只依赖迭代下标，不读取任何共享状态，
+// 因此同一交易在任何节点上的耗时与 gas 都是可复现的。
+// 单条 WORK 可能运行很久，因此迭代中也会检查取消信号。
+func work(ctx *Context, in *Instruction) error {
+	n := in.Uint64[0]
+	cost := n / WorkPerGas
+	if n%WorkPerGas != 0 {
+		cost++
+	}
+	if err := ctx.useDynamicGas(cost, "WORK"); err != nil {
+		return err
+	}
+	x, acc := n, 0.0
+	for i := uint64(0); i < n; i++ {
+		if i&(workInterruptInterval-1) == workInterruptInterval-1 {
+			if err := ctx.vm.interrupted(); err != nil {
+				return err
+			}
+		}
+		// splitmix64
+		x += 0x9e3779b97f4a7c15
+		z := (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		acc += math.Atan(math.Sqrt(float64(z ^ (z >> 31))))
 	}
+	_ = acc
 	return nil
 }
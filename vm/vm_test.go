@@ -1,35 +1,1451 @@
 package vm
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
 	"neochain/common"
 	"neochain/utils"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
-func TestEngine02(t *testing.T) {
+// TestConformance 执行 testdata/conformance 中的全部测试向量。
+// 每个文件是一个 conformanceVector 的 JSON 数组，向量只描述执行前后的状态，不依赖本包的实现，
+// 其他解释器可以读取同一组文件检查自己的语义；修改操作码的语义或 gas 时需要同步修改向量
+func TestConformance(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "conformance", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no conformance vectors")
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var vectors []conformanceVector
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&vectors); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		group := strings.TrimSuffix(filepath.Base(file), ".json")
+		for _, v := range vectors {
+			v := v
+			t.Run(group+"/"+v.Name, func(t *testing.T) {
+				v.run(t)
+			})
+		}
+	}
+}
+
+// conformanceVector 是一个测试向量。字节串写作 0x 开头的十六进制；
+// 栈元素与 topic 写作十进制、0x 开头的十六进制或负数，负数按位宽取补码
+type conformanceVector struct {
+	Name          string   `json:"name"`
+	WordSize      WordSize `json:"wordSize"` // 64 或 256，缺省为 64
+	CheckOverflow bool     `json:"checkOverflow"`
+	GasLimit      uint64   `json:"gasLimit"`  // 缺省为 common.DefaultGasLimit
+	MaxMemory     uint64   `json:"maxMemory"` // 缺省为 DefaultMaxMemory
+	Code          []string `json:"code"`      // 汇编程序，每个元素一行，以 TxExec 交易执行
+
+	Pre struct {
+		Memory     hexBytes            `json:"memory"`
+		MemorySize int                 `json:"memorySize"` // memory 之后补 0 到这个大小，NewMemory 至少补到 32 字节
+		State      map[string]hexBytes `json:"state"`
+		CallData   hexBytes            `json:"callData"`
+		Block      struct {
+			Height    uint64   `json:"height"`
+			Timestamp uint64   `json:"timestamp"`
+			PrevHash  hexBytes `json:"prevHash"`
+			TxHash    hexBytes `json:"txHash"`
+			Caller    string   `json:"caller"`
+		} `json:"block"`
+	} `json:"pre"`
+
+	Post struct {
+		Memory     hexBytes            `json:"memory"`
+		MemorySize int                 `json:"memorySize"` // 执行后的内存大小，memory 之后的部分全为 0
+		Stack      []string            `json:"stack"`      // 从栈底到栈顶，出错时为出错那一刻的栈
+		State      map[string]hexBytes `json:"state"`      // 执行后的全部状态
+		ReturnData hexBytes            `json:"returnData"`
+		Logs       []struct {
+			Topics []string `json:"topics"`
+			Data   hexBytes `json:"data"`
+		} `json:"logs"`
+		Error   string `json:"error"` // errorClass 给出的错误类别，成功时为 "ok"
+		GasUsed uint64 `json:"gasUsed"`
+	} `json:"post"`
+}
+
+func (v *conformanceVector) run(t *testing.T) {
+	code, err := Assemble(strings.Join(v.Code, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := v.WordSize
+	if size == 0 {
+		size = Word64
+	}
+	engine := NewVM(zeroPad(v.Pre.Memory, v.Pre.MemorySize))
+	engine.WordSize = size
+	engine.CheckOverflow = v.CheckOverflow
+	if v.MaxMemory != 0 {
+		engine.MaxMemory = v.MaxMemory
+	}
+	for key, value := range v.Pre.State {
+		_ = engine.State.Put(key, value)
+	}
+	engine.Block = BlockContext{
+		Height:    v.Pre.Block.Height,
+		Timestamp: v.Pre.Block.Timestamp,
+		PrevHash:  v.Pre.Block.PrevHash,
+		TxHash:    v.Pre.Block.TxHash,
+	}
+	if v.Pre.Block.Caller != "" {
+		engine.Block.Caller = parseWord(t, size, v.Pre.Block.Caller)
+	}
+	gasLimit := v.GasLimit
+	if gasLimit == 0 {
+		gasLimit = common.DefaultGasLimit
+	}
+
+	result, err := engine.ExecuteTransaction(&common.Transaction{Code: code, Data: v.Pre.CallData, GasLimit: gasLimit})
+	if class := errorClass(err); class != v.Post.Error {
+		t.Errorf("error %q (%v), want %q", class, err, v.Post.Error)
+	}
+	if result.GasUsed != v.Post.GasUsed {
+		t.Errorf("gas used %d, want %d", result.GasUsed, v.Post.GasUsed)
+	}
+	if want := zeroPad(v.Post.Memory, v.Post.MemorySize); !bytes.Equal(engine.Context.Memory.Cell, want) {
+		t.Errorf("memory %x, want %x", engine.Context.Memory.Cell, want)
+	}
+	stack := make([]Word, len(v.Post.Stack))
+	for i, s := range v.Post.Stack {
+		stack[i] = parseWord(t, size, s)
+	}
+	if got := engine.Context.Stack; len(got) != len(stack) || (len(got) > 0 && !reflect.DeepEqual(got, stack)) {
+		t.Errorf("stack %v, want %v", got, stack)
+	}
+	state := engine.State.(MemState)
+	if len(state) != len(v.Post.State) {
+		t.Errorf("state has %d keys, want %d", len(state), len(v.Post.State))
+	}
+	for key, want := range v.Post.State {
+		if got, ok := state[key]; !ok || !bytes.Equal(got, want) {
+			t.Errorf("state %s = %x, want %x", key, got, []byte(want))
+		}
+	}
+	if !bytes.Equal(result.ReturnData, v.Post.ReturnData) {
+		t.Errorf("return data %x, want %x", result.ReturnData, []byte(v.Post.ReturnData))
+	}
+	logs := make([]common.Log, len(v.Post.Logs))
+	for i, l := range v.Post.Logs {
+		logs[i] = common.Log{Topics: make([]Word, len(l.Topics)), Data: l.Data}
+		for j, s := range l.Topics {
+			logs[i].Topics[j] = parseWord(t, size, s)
+		}
+	}
+	if len(result.Logs) != len(logs) || (len(logs) > 0 && !reflect.DeepEqual(result.Logs, logs)) {
+		t.Errorf("logs %+v, want %+v", result.Logs, logs)
+	}
+}
+
+// parseWord 解析向量中的一个栈元素或 topic
+func parseWord(t *testing.T, size WordSize, s string) Word {
+	t.Helper()
+	n, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		t.Fatalf("invalid word %q", s)
+	}
+	if n.Sign() < 0 {
+		n.Add(n, new(big.Int).Lsh(big.NewInt(1), uint(size)))
+	}
+	if n.Sign() < 0 || n.BitLen() > int(size) {
+		t.Fatalf("word %q does not fit in %d bits", s, size)
+	}
+	return common.WordFromBig(n)
+}
+
+// hexBytes 是 JSON 中以 0x 开头的十六进制字节串
+type hexBytes []byte
+
+func (b *hexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(s, "0x") {
+		return fmt.Errorf("hex string %q without 0x prefix", s)
+	}
+	v, err := hex.DecodeString(s[2:])
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+// zeroPad 返回 b 补 0 到 size 字节的副本，size 不足 len(b) 时不截断
+func zeroPad(b []byte, size int) []byte {
+	if size < len(b) {
+		size = len(b)
+	}
+	out := make([]byte, size)
+	copy(out, b)
+	return out
+}
+
+func TestOutOfGas(t *testing.T) {
 	engine := NewVM(make([]byte, 1024))
 
-	t.Logf("mem: %x", utils.LongBytesToInt(engine.Context.Memory.Cell))
+	// JMP 跳回自身，程序永远不会结束
+	transaction := &common.Transaction{
+		Code: []common.Opcode{
+			{Name: "JMP", Args: []interface{}{0}},
+		},
+		GasLimit: 1000,
+	}
+	result, err := engine.ExecuteTransaction(transaction)
+	if !errors.Is(err, ErrOutOfGas) {
+		t.Fatalf("expected out of gas, got %v", err)
+	}
+	if result.GasUsed != transaction.GasLimit {
+		t.Errorf("gas used %d, want %d", result.GasUsed, transaction.GasLimit)
+	}
+}
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	transaction := common.NewTransaction(2, 1)
+	transaction.Code = append(transaction.Code, common.Opcode{Name: "STOREI", Args: []interface{}{uint64(24), []byte{0xca, 0xfe}}})
+
+	data, err := json.Marshal(transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded common.Transaction
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	direct := NewVM(make([]byte, 1024))
+	if _, err := direct.ExecuteTransaction(transaction); err != nil {
+		t.Fatal(err)
+	}
+	viaJson := NewVM(make([]byte, 1024))
+	if _, err := viaJson.ExecuteTransaction(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(direct.Context.Memory.Cell, viaJson.Context.Memory.Cell) {
+		t.Errorf("decoded transaction produced different memory")
+	}
+	if !reflect.DeepEqual(direct.State, viaJson.State) {
+		t.Errorf("decoded transaction produced different state")
+	}
+
+	encoded, err := common.EncodeCode(transaction.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := common.EncodeCode(decoded.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, again) {
+		t.Errorf("encoding is not deterministic")
+	}
+	if _, err := common.DecodeCode(encoded[:len(encoded)-1]); !errors.Is(err, common.ErrInvalidBytecode) {
+		t.Errorf("expected ErrInvalidBytecode for truncated input, got %v", err)
+	}
+}
+
+func TestAssembleDisassemble(t *testing.T) {
+	src := `
+	.const LIMIT 128      ; 分支阈值
+	.const HALF 2
+		LOAD 0, 8
+		DUP
+		PUSH LIMIT
+		CMP
+		JEQ small, 0      # val <= LIMIT
+		PUSH HALF
+		DIV
+		JMP done
+	small:
+		PUSH 32
+		ADD
+	done: STORE 8
+		STOREI 16 "ok"
+	`
+	code, err := Assemble(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 12 {
+		t.Fatalf("got %d instructions, want 12", len(code))
+	}
+	if target := code[4].Args[0].(int); target != 8 {
+		t.Errorf("JEQ target %d, want 8", target)
+	}
+	if target := code[7].Args[0].(int); target != 10 {
+		t.Errorf("JMP target %d, want 10", target)
+	}
 
-	transaction := common.NewTransaction(0, 2)
-	err := engine.ExecuteTransaction(transaction)
+	out, err := Disassemble(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := Assemble(out)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf("reassemble: %v\n%s", err, out)
+	}
+	a, _ := common.EncodeCode(code)
+	b, _ := common.EncodeCode(again)
+	if !bytes.Equal(a, b) {
+		t.Errorf("disassembly does not round trip:\n%s", out)
+	}
+
+	for _, bad := range []string{"FOO", "PUSH", "JMP nowhere", "STOREI 0 cafe", "x: PUSH 1\nx: PUSH 2"} {
+		if _, err := Assemble(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
 	}
-	t.Logf("ret: %x", engine.Context.Peek())
-	t.Logf("mem: %x", utils.LongBytesToInt(engine.Context.Memory.Cell))
 }
 
-func TestEngine21(t *testing.T) {
+func TestReadWriteSet(t *testing.T) {
+	engine := NewVM(make([]byte, 32))
+	transaction := &common.Transaction{
+		Code: []common.Opcode{
+			{Name: "LOAD", Args: []interface{}{uint64(0), uint64(16)}},
+			{Name: "LOAD", Args: []interface{}{uint64(8), uint64(16)}},
+			{Name: "STORE", Args: []interface{}{uint64(24)}},
+			{Name: "STOREI", Args: []interface{}{uint64(4), []byte{1, 2}}},
+			{Name: "MALLOC", Args: []interface{}{uint64(8)}},
+		},
+		GasLimit: common.DefaultGasLimit,
+	}
+	result, err := engine.ExecuteTransaction(transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantReads := []Range{{0, 24}}
+	wantWrites := []Range{{4, 2}, {24, 16}}
+	if !reflect.DeepEqual(result.ReadSet, wantReads) {
+		t.Errorf("read set %v, want %v", result.ReadSet, wantReads)
+	}
+	if !reflect.DeepEqual(result.WriteSet, wantWrites) {
+		t.Errorf("write set %v, want %v", result.WriteSet, wantWrites)
+	}
+	rwSet := result.RWSet()
+	if got := rwSet.WSet[MemorySpace]; !reflect.DeepEqual(got, []string{"4:2", "24:16"}) {
+		t.Errorf("RWSet.WSet = %v", got)
+	}
+}
+
+func TestJSONTracer(t *testing.T) {
 	engine := NewVM(make([]byte, 1024))
+	buf := bytes.NewBuffer(nil)
+	engine.Tracer = NewJSONTracer(buf)
+
+	transaction := &common.Transaction{
+		Code: []common.Opcode{
+			{Name: "PUSH", Args: []interface{}{uint64(7)}},
+			{Name: "STORE", Args: []interface{}{uint64(0)}},
+			{Name: "STORE", Args: []interface{}{uint64(1024)}},
+		},
+		GasLimit: common.DefaultGasLimit,
+	}
+	if _, err := engine.ExecuteTransaction(transaction); !errors.Is(err, ErrMemoryOutOfBounds) {
+		t.Fatalf("expected ErrMemoryOutOfBounds, got %v", err)
+	}
+
+	events := make([]string, 0)
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var ev struct {
+			Event string `json:"event"`
+		}
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev.Event)
+	}
+	want := []string{"step", "step", "memory", "step", "error", "exit"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events %v, want %v", events, want)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	if err := Verify(common.NewTransaction(0, 2).Code); err != nil {
+		t.Errorf("NewTransaction program rejected: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		src  string
+		want error
+	}{
+		{"loop", "loop: PUSH 1\nJEQ loop 1\nSTORE 0", nil},
+		{"load pushes", "LOAD 0 16\nADD\nSTORE 0", nil},
+		{"underflow", "PUSH 1\nADD", ErrStackUnderflow},
+		{"underflow on one path", "PUSH 1\nJEQ skip 0\nPUSH 2\nskip: ADD", ErrStackUnderflow},
+		{"underflow after jump", "JMP end\nPUSH 1\nend: DUP", ErrStackUnderflow},
+		{"loop consumes stack", "PUSH 1\nPUSH 2\nloop: ADD\nJMP loop", ErrStackUnderflow},
+		{"swap underflow", "PUSH 1\nSWAP1", ErrStackUnderflow},
+		{"dup depth", "PUSH 1\nPUSH 2\nDUP2\nDUP3", nil},
+		{"jumpi falls through", "PUSH 1\nPUSH 0\nJUMPI\nPOP", ErrStackUnderflow},
+		{"load overflow", "LOAD 0 8200", ErrStackOverflow},
+		{"load at limit", "LOAD 0 8192", nil},
+		{"huge load", "LOAD 0 0xffffffffffffffff", ErrStackOverflow},
+		{"push overflow", strings.Repeat("PUSH 1\n", MaxStackDepth+1), ErrStackOverflow},
+		{"loop may overflow", "loop: PUSH 1\nJMP loop", nil},
+	}
+	for _, c := range cases {
+		code, err := Assemble(c.src)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if err := Verify(code); !errors.Is(err, c.want) || (c.want == nil && err != nil) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	raw := []struct {
+		name string
+		code []common.Opcode
+		want error
+	}{
+		{"unknown", []common.Opcode{{Name: "NOPE"}}, ErrUnknownOpcode},
+		{"arg count", []common.Opcode{{Name: "PUSH"}}, ErrInvalidOperand},
+		{"arg type", []common.Opcode{{Name: "PUSH", Args: []interface{}{float64(1)}}}, ErrInvalidOperand},
+		{"jump range", []common.Opcode{{Name: "JMP", Args: []interface{}{2}}}, ErrInvalidJump},
+		{"negative jump", []common.Opcode{{Name: "JMP", Args: []interface{}{-1}}}, ErrInvalidJump},
+	}
+	for _, c := range raw {
+		if err := Verify(c.code); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
+
+func TestMemoryJournal(t *testing.T) {
+	mem := NewMemory([]byte{1, 2, 3, 4})
+	before := append([]byte(nil), mem.Cell...)
+
+	outer := mem.Checkpoint()
+	_ = mem.Store(0, []byte{9, 9})
+	inner := mem.Checkpoint()
+	_ = mem.Set(2, 7)
+	mem.Malloc(32, 16)
+	mem.RevertTo(inner)
+	if mem.Size() != 32 || mem.Cell[2] != 3 || mem.Cell[0] != 9 {
+		t.Fatalf("inner revert: size %d, cell %x", mem.Size(), mem.Cell[:4])
+	}
+	inner = mem.Checkpoint()
+	_ = mem.StoreNBytes(1, 2, []byte{5, 5})
+	mem.Commit(inner)
+	if mem.Cell[1] != 5 {
+		t.Fatalf("commit lost write: %x", mem.Cell[:4])
+	}
+	mem.RevertTo(outer)
+	if !bytes.Equal(mem.Cell, before) {
+		t.Errorf("outer revert: got %x, want %x", mem.Cell, before)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	run := func(src string, limit uint64) (*VM, *ExecutionResult, error) {
+		t.Helper()
+		code, err := Assemble(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		engine := NewVM(nil)
+		engine.MaxMemory = limit
+		result, err := engine.ExecuteTransaction(&common.Transaction{Code: code, GasLimit: common.DefaultGasLimit})
+		return engine, result, err
+	}
+
+	engine, result, err := run("MALLOC 96\nPOP", 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MemorySize != 128 || result.MemoryExpanded != 96 || engine.Context.Memory.Size() != 128 {
+		t.Errorf("memory size %d, expanded %d", result.MemorySize, result.MemoryExpanded)
+	}
+	if want := GasAlloc + memoryExpansionGas(32, 128) + GasQuick; result.GasUsed != want {
+		t.Errorf("gas used %d, want %d", result.GasUsed, want)
+	}
+
+	// 超过上限的分配在扩展之前被拒绝，不会真的申请内存
+	for _, size := range []uint64{1024, 1 << 62, math.MaxUint64} {
+		engine, result, err = run(fmt.Sprintf("MALLOC 32\nPOP\nMALLOC %d", size), 1024)
+		if !errors.Is(err, ErrOutOfMemory) {
+			t.Errorf("MALLOC %d: got %v, want ErrOutOfMemory", size, err)
+		}
+		if engine.Context.Memory.Size() != 32 || result.MemorySize != 64 {
+			t.Errorf("MALLOC %d: memory size %d after revert, %d recorded", size, engine.Context.Memory.Size(), result.MemorySize)
+		}
+	}
+
+	// 上限之内，扩展费用随大小按平方增长
+	if _, _, err := run("MALLOC 1048576", DefaultMaxMemory); !errors.Is(err, ErrOutOfGas) {
+		t.Errorf("1 MiB allocation: got %v, want ErrOutOfGas", err)
+	}
+	if _, _, err := run("MALLOC 1048576\nPOP", 0); !errors.Is(err, ErrOutOfGas) {
+		t.Errorf("unlimited memory: got %v, want ErrOutOfGas", err)
+	}
 
-	t.Logf("mem: %x", utils.LongBytesToInt(engine.Context.Memory.Cell))
+	// 偏移量加长度溢出时按越界处理
+	if _, _, err := run("LOAD 0xffffffffffffffff, 8", 0); !errors.Is(err, ErrMemoryOutOfBounds) {
+		t.Errorf("wrapping LOAD: got %v", err)
+	}
+
+	// 复用的 VM 上记录的是每个交易自己的内存，不随交易累积
+	code, _ := Assemble("MALLOC 1000")
+	engine = NewVM(nil)
+	for i := 0; i < 3; i++ {
+		result, err := engine.ExecuteTransaction(&common.Transaction{Code: code, GasLimit: common.DefaultGasLimit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.MemorySize != 1032 || result.MemoryExpanded != 1000 {
+			t.Errorf("transaction %d: memory size %d, expanded %d", i, result.MemorySize, result.MemoryExpanded)
+		}
+	}
+}
+
+func TestExecuteTransactionContext(t *testing.T) {
+	loop, _ := Assemble("PUSH 1\nSTORE 0\nloop: JMP loop")
+	infinite := &common.Transaction{Code: loop, GasLimit: math.MaxUint64}
+
+	engine := NewVM(nil)
+	result, err := engine.ExecuteTransactionContext(context.Background(), infinite, Limits{MaxSteps: 100})
+	if !errors.Is(err, ErrStepLimit) {
+		t.Fatalf("step limit: got %v", err)
+	}
+	if result.Steps != 101 || result.GasUsed != GasQuick+GasMemory+GasCopyWord+98*GasMid {
+		t.Errorf("steps %d, gas used %d", result.Steps, result.GasUsed)
+	}
+	if engine.Context.Memory.Cell[7] != 0 {
+		t.Errorf("aborted transaction left its write in memory")
+	}
+
+	// 反复覆盖同一段内存按写入的字数付费
+	rewrite, _ := Assemble("MALLOC 4096\nPOP\nloop: STOREI 32 0x" + strings.Repeat("ab", 4096) + "\nJMP loop")
+	result, err = engine.ExecuteTransaction(&common.Transaction{Code: rewrite, GasLimit: common.DefaultGasLimit})
+	if !errors.Is(err, ErrOutOfGas) {
+		t.Fatalf("rewrite loop: got %v", err)
+	}
+	if result.Steps > 2*common.DefaultGasLimit/(GasCopyWord*128) {
+		t.Errorf("rewrite loop ran %d steps", result.Steps)
+	}
+
+	start := time.Now()
+	_, err = engine.ExecuteTransactionContext(context.Background(), infinite, Limits{Timeout: 20 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("timeout: got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timeout took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := engine.ExecuteTransactionContext(ctx, infinite, Limits{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled: got %v", err)
+	}
+
+	// 单条 WORK 也会响应取消；次数不能绕过 gas 计价
+	work, _ := Assemble("WORK 0xffffffffffffffff")
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := engine.ExecuteTransactionContext(ctx, &common.Transaction{Code: work, GasLimit: math.MaxUint64}, Limits{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WORK: got %v", err)
+	}
+	if _, err := engine.ExecuteTransaction(&common.Transaction{Code: work, GasLimit: common.DefaultGasLimit}); !errors.Is(err, ErrOutOfGas) {
+		t.Errorf("WORK with default gas: got %v", err)
+	}
 
-	transaction := common.NewTransaction(1, 3)
-	err := engine.ExecuteTransaction(transaction)
+	// 限制只作用于一次执行
+	result, err = engine.ExecuteTransaction(&common.Transaction{Code: loop[:2], GasLimit: common.DefaultGasLimit})
+	if err != nil || result.Steps != 2 {
+		t.Errorf("unlimited execution: steps %d, err %v", result.Steps, err)
+	}
+}
+
+func TestFailedTransactionLeavesNoState(t *testing.T) {
+	for _, src := range []string{
+		"PUSH 5\nSTORE 0\nMALLOC 64\nREVERT",
+		"PUSH 5\nSTORE 0\nMALLOC 64\nSTORE 4096",
+		"PUSH 5\nSTORE 0\nADD",
+	} {
+		code, err := Assemble(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		engine := NewVM([]byte{1, 2, 3})
+		before := append([]byte(nil), engine.Context.Memory.Cell...)
+		_, err = engine.ExecuteTransaction(&common.Transaction{Code: code, GasLimit: common.DefaultGasLimit})
+		if err == nil {
+			t.Fatalf("%q: expected an error", src)
+		}
+		if !bytes.Equal(engine.Context.Memory.Cell, before) {
+			t.Errorf("%q: memory changed after %v", src, err)
+		}
+	}
+}
+
+// TestMemoryPerTransaction 同一个 VM 上的每个交易都从初始内存开始
+func TestMemoryPerTransaction(t *testing.T) {
+	engine := NewVM([]byte{1, 2, 3})
+	write, _ := Assemble("STOREI 0 0xff\nMALLOC 1000")
+	read, _ := Assemble("LOAD 0, 1")
+	first, err := engine.ExecuteTransaction(&common.Transaction{Code: write, GasLimit: common.DefaultGasLimit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := engine.ExecuteTransaction(&common.Transaction{Code: write, GasLimit: common.DefaultGasLimit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.GasUsed != second.GasUsed {
+		t.Errorf("MALLOC gas %d then %d", first.GasUsed, second.GasUsed)
+	}
+	if _, err := engine.ExecuteTransaction(&common.Transaction{Code: read, GasLimit: common.DefaultGasLimit}); err != nil {
+		t.Fatal(err)
+	}
+	if got := engine.Context.Peek().Uint64(); got != 1<<56 {
+		t.Errorf("read %#x written by an earlier transaction", got)
+	}
+	if size := engine.Context.Memory.Size(); size != 32 {
+		t.Errorf("memory size %d after a read-only transaction", size)
+	}
+}
+
+func TestStorage(t *testing.T) {
+	state := NewMemState()
+	_ = state.Put(StorageKey("", []byte("slot"), 1), utils.UintToBytes(200))
+	engine := NewVMWithState(state)
+
+	result, err := engine.ExecuteTransaction(common.NewTransaction(1, 2))
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatal(err)
+	}
+	got, _ := state.Get(StorageKey("", []byte("slot"), 2))
+	if utils.BytesToInt(got) != 0 {
+		// 200 > 128，CMP 得到 1，1/2 = 0
+		t.Errorf("slot[2] = %d, want 0", utils.BytesToInt(got))
+	}
+	if !reflect.DeepEqual(result.StateReadSet, []string{"slot[1]"}) || !reflect.DeepEqual(result.StateWriteSet, []string{"slot[2]"}) {
+		t.Errorf("state access set %v / %v", result.StateReadSet, result.StateWriteSet)
+	}
+
+	// 回滚的交易不会写入状态
+	code, err := Assemble("PUSH 7\nPUSH 3\nSSTORE \"x\"\nREVERT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.ExecuteTransaction(&common.Transaction{Code: code, GasLimit: common.DefaultGasLimit}); !errors.Is(err, ErrExecutionReverted) {
+		t.Fatalf("expected revert, got %v", err)
+	}
+	if v, _ := state.Get(StorageKey("", []byte("x"), 3)); v != nil {
+		t.Errorf("reverted SSTORE left %x in state", v)
+	}
+}
+
+func TestCallData(t *testing.T) {
+	data := make([]byte, 40)
+	data[31] = 7                        // 槽位 0 为 7
+	copy(data[32:], "\x01\x02\x03\x04") // 槽位 1 只有前 8 字节，其余按 0 补齐
+	code, err := Assemble(`
+		PUSH 0
+		CALLDATALOAD
+		CALLDATASIZE
+		PUSH 32
+		CALLDATALOAD
+		PUSH 1000     ; 超出调用数据的部分为 0
+		CALLDATALOAD
+		PUSH 16       ; 长度
+		PUSH 30       ; 调用数据偏移量
+		PUSH 0        ; 内存偏移量
+		CALLDATACOPY
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(code); err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []WordSize{Word64, Word256} {
+		engine := NewVM(nil)
+		engine.WordSize = size
+		if _, err := engine.ExecuteTransaction(&common.Transaction{Code: code, Data: data, GasLimit: common.DefaultGasLimit}); err != nil {
+			t.Fatal(err)
+		}
+		slot1 := utils.BytesToWord(append([]byte{1, 2, 3, 4}, make([]byte, 28)...))
+		if size == Word64 {
+			slot1 = Word{} // 64 位模式只保留低 64 位
+		}
+		if want := []Word{common.NewWord(7), common.NewWord(40), slot1, {}}; !reflect.DeepEqual(engine.Context.Stack, want) {
+			t.Errorf("%d-bit stack %v, want %v", size, engine.Context.Stack, want)
+		}
+		if want := append(append([]byte{0, 7}, data[32:40]...), make([]byte, 6)...); !bytes.Equal(engine.Context.Memory.Cell[:16], want) {
+			t.Errorf("%d-bit CALLDATACOPY wrote %x, want %x", size, engine.Context.Memory.Cell[:16], want)
+		}
+	}
+
+	// CALL 的参数同时是被调用方的调用数据
+	engine := NewVM(nil)
+	callee, _ := Assemble("PUSH 0\nCALLDATALOAD\nPUSH 1\nADD\nSTORE 0\nPUSH 8\nPUSH 0\nRETURN")
+	deployed, err := engine.ExecuteTransaction(&common.Transaction{Type: common.TxDeploy, Code: callee, GasLimit: common.DefaultGasLimit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoked, err := engine.ExecuteTransaction(&common.Transaction{Type: common.TxInvoke, To: deployed.ContractAddress, Data: data[:32], GasLimit: common.DefaultGasLimit})
+	if err != nil || utils.BytesToInt(invoked.ReturnData) != 8 {
+		t.Fatalf("invoke returned %x, %v", invoked.ReturnData, err)
+	}
+	caller, _ := Assemble(fmt.Sprintf("STOREI 31 0x09\nPUSH 32\nPUSH 0\nCALL %q\nPUSH 0\nRETURNDATACOPY", deployed.ContractAddress))
+	if _, err := engine.ExecuteTransaction(&common.Transaction{Code: caller, GasLimit: common.DefaultGasLimit}); err != nil {
+		t.Fatal(err)
+	}
+	if got := utils.BytesToInt(engine.Context.Memory.Cell[:8]); got != 10 {
+		t.Errorf("CALL returned %d, want 10", got)
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	prev := sha256.Sum256([]byte("block 6"))
+	tx := sha256.Sum256([]byte("tx"))
+	block := BlockContext{Height: 7, Timestamp: 1700000000, PrevHash: prev[:], TxHash: tx[:], Caller: common.NewWord(42)}
+	code, _ := Assemble("HEIGHT\nTIMESTAMP\nPREVHASH\nTXHASH\nCALLER")
+	for _, size := range []WordSize{Word64, Word256} {
+		engine := NewVM(nil)
+		engine.WordSize = size
+		engine.Block = block
+		if _, err := engine.ExecuteTransaction(&common.Transaction{Code: code, GasLimit: common.DefaultGasLimit}); err != nil {
+			t.Fatal(err)
+		}
+		want := []Word{common.NewWord(7), common.NewWord(1700000000), utils.BytesToWord(prev[:]), utils.BytesToWord(tx[:]), common.NewWord(42)}
+		if size == Word64 {
+			want[2], want[3] = common.NewWord(utils.BytesToInt(prev[24:])), common.NewWord(utils.BytesToInt(tx[24:]))
+		}
+		if !reflect.DeepEqual(engine.Context.Stack, want) {
+			t.Errorf("%d-bit stack %v, want %v", size, engine.Context.Stack, want)
+		}
+	}
+
+	// 被调用的合约看到的 CALLER 是调用它的合约，直接执行的代码调用合约时是交易的发送方
+	engine := NewVM(nil)
+	engine.WordSize = Word256
+	engine.Block = block
+	deploy := func(src string) string {
+		t.Helper()
+		code, err := Assemble(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := engine.ExecuteTransaction(&common.Transaction{Type: common.TxDeploy, Code: code, GasLimit: common.DefaultGasLimit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.ContractAddress
+	}
+	inner := deploy("CALLER\nPUSH 0\nSSTORE \"caller\"")
+	outer := deploy(fmt.Sprintf("PUSH 0\nPUSH 0\nCALL %q", inner))
+	for _, c := range []struct {
+		tx   *common.Transaction
+		want Word
+	}{
+		{&common.Transaction{Type: common.TxInvoke, To: outer}, AddressWord(outer)},
+		{&common.Transaction{Code: []common.Opcode{{Name: "PUSH", Args: []interface{}{uint64(0)}}, {Name: "PUSH", Args: []interface{}{uint64(0)}}, {Name: "CALL", Args: []interface{}{[]byte(inner)}}}}, common.NewWord(42)},
+	} {
+		c.tx.GasLimit = common.DefaultGasLimit
+		if _, err := engine.ExecuteTransaction(c.tx); err != nil {
+			t.Fatal(err)
+		}
+		value, _ := engine.State.Get(StorageKey(inner, []byte("caller"), 0))
+		if got := utils.BytesToWord(value); got != c.want {
+			t.Errorf("CALLER %s, want %s", got.Hex(), c.want.Hex())
+		}
+	}
+}
+
+func TestDeployAndCall(t *testing.T) {
+	state := NewMemState()
+	engine := NewVMWithState(state)
+	run := func(tx *common.Transaction) *ExecutionResult {
+		t.Helper()
+		if tx.GasLimit == 0 {
+			tx.GasLimit = common.DefaultGasLimit
+		}
+		result, err := engine.ExecuteTransaction(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// 被调用方：把输入翻倍，记录在自己的存储中并返回
+	callee, err := Assemble(`
+		LOAD 0 8
+		PUSH 2
+		MUL
+		DUP
+		PUSH 0
+		SSTORE "last"
+		STORE 0
+		PUSH 8
+		PUSH 0
+		RETURN
+		PUSH 1        ; RETURN 之后的指令不会执行
+		PUSH 0
+		SSTORE "last"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := run(&common.Transaction{Type: common.TxDeploy, Code: callee}).ContractAddress
+	if address == "" {
+		t.Fatal("deploy returned no address")
+	}
+	// 同一段代码可以再次部署，得到由部署方与 nonce 决定的新地址
+	if again := run(&common.Transaction{Type: common.TxDeploy, Code: callee}).ContractAddress; again == address || again != ContractAddress(Word{}, 1, nil) {
+		t.Errorf("redeploy: address %s, first deploy %s", again, address)
+	}
+	engine.Block.Caller = common.NewWord(7)
+	if other := run(&common.Transaction{Type: common.TxDeploy, Code: callee}).ContractAddress; other != ContractAddress(common.NewWord(7), 0, nil) {
+		t.Errorf("deploy by another sender: address %s", other)
+	}
+	// 冒用同一发送方与 nonce 的部署交易哈希不同，得到不同的地址
+	if ContractAddress(common.NewWord(7), 0, []byte("victim")) == ContractAddress(common.NewWord(7), 0, []byte("forger")) {
+		t.Errorf("address does not depend on the deploying transaction")
+	}
+	engine.Block.Caller = Word{}
+
+	invoked := run(&common.Transaction{Type: common.TxInvoke, To: address})
+	if !bytes.Equal(invoked.ReturnData, make([]byte, 8)) {
+		t.Errorf("invoke returned %x", invoked.ReturnData)
+	}
+
+	caller, err := Assemble(fmt.Sprintf(`
+		STOREI 0 0x0000000000000015
+		PUSH 8
+		PUSH 0
+		CALL %q
+		PUSH 8
+		RETURNDATACOPY
+		LOAD 8 8
+		PUSH 0
+		SSTORE "result"
+	`, address))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := run(&common.Transaction{Code: caller})
+	if got := engine.Context.Stack; !reflect.DeepEqual(got, words(1)) {
+		t.Errorf("caller stack %v, want [1]", got)
+	}
+	for key, want := range map[string]uint64{
+		StorageKey("", []byte("result"), 0):    42,
+		StorageKey(address, []byte("last"), 0): 42,
+	} {
+		if v, _ := state.Get(key); utils.BytesToInt(v) != want {
+			t.Errorf("%s = %d, want %d", key, utils.BytesToInt(v), want)
+		}
+	}
+	if len(result.StateReadSet) == 0 || !strings.Contains(strings.Join(result.StateReadSet, ","), address) {
+		t.Errorf("callee reads missing from read set: %v", result.StateReadSet)
+	}
+
+	// 失败的调用压入 0，被调用方的写入被丢弃，调用方继续执行
+	failing, _ := Assemble("PUSH 9\nPUSH 0\nSSTORE \"x\"\nREVERT")
+	_ = state.Put(CodeKey("failing"), mustEncode(t, failing))
+	caller, _ = Assemble("PUSH 0\nPUSH 0\nCALL \"failing\"")
+	run(&common.Transaction{Code: caller})
+	if got := engine.Context.Stack; !reflect.DeepEqual(got, words(0)) {
+		t.Errorf("failed call pushed %v, want [0]", got)
+	}
+	if v, _ := state.Get(StorageKey("failing", []byte("x"), 0)); v != nil {
+		t.Errorf("failed call left state behind")
+	}
+
+	// 参数与返回数据的复制按字收费，被调用方超出 32 字节的初始内存按内存扩展的价格收费
+	echo, _ := Assemble("CALLDATASIZE\nPUSH 0\nRETURN")
+	_ = state.Put(CodeKey("echo"), mustEncode(t, echo))
+	copying := func(size int) uint64 {
+		t.Helper()
+		code, _ := Assemble(fmt.Sprintf("MALLOC 4096\nPOP\nPUSH %d\nPUSH 0\nCALL \"echo\"\nPUSH 0\nRETURNDATACOPY", size))
+		return run(&common.Transaction{Code: code}).GasUsed
+	}
+	if got, want := copying(4096)-copying(32), 2*GasCopyWord*127+memoryExpansionGas(32, 4096); got != want {
+		t.Errorf("copying 4096 bytes costs %d more than 32 bytes, want %d", got, want)
+	}
+
+	// 无限递归在 MaxCallDepth 处失败，不会拖垮整个交易
+	loop, _ := Assemble("PUSH 0\nPUSH 0\nCALL \"loop\"")
+	_ = state.Put(CodeKey("loop"), mustEncode(t, loop))
+	run(&common.Transaction{Type: common.TxInvoke, To: "loop"})
+}
+
+func TestLog(t *testing.T) {
+	state := NewMemState()
+	engine := NewVMWithState(state)
+	emitter, _ := Assemble(`
+		STOREI 0 "hello"
+		PUSH 7        ; topic
+		PUSH 5
+		PUSH 0
+		LOG1
+	`)
+	_ = state.Put(CodeKey("emitter"), mustEncode(t, emitter))
+
+	code, _ := Assemble(`
+		STOREI 0 "ab"
+		PUSH 2
+		PUSH 1
+		PUSH 2
+		PUSH 0
+		LOG2
+		PUSH 0
+		PUSH 0
+		CALL "emitter"
+	`)
+	result, err := engine.ExecuteTransaction(&common.Transaction{Code: code, GasLimit: common.DefaultGasLimit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []common.Log{
+		{Topics: words(1, 2), Data: []byte("ab")},
+		{Address: "emitter", Topics: words(7), Data: []byte("hello")},
+	}
+	if !reflect.DeepEqual(result.Logs, want) {
+		t.Errorf("logs %+v, want %+v", result.Logs, want)
+	}
+
+	// 数据越长花费越多
+	short, _ := Assemble("PUSH 1\nPUSH 0\nLOG0")
+	long, _ := Assemble("PUSH 30\nPUSH 0\nLOG0")
+	r1, _ := engine.ExecuteTransaction(&common.Transaction{Code: short, GasLimit: common.DefaultGasLimit})
+	r2, _ := engine.ExecuteTransaction(&common.Transaction{Code: long, GasLimit: common.DefaultGasLimit})
+	if r2.GasUsed-r1.GasUsed != 29*GasLogByte {
+		t.Errorf("log gas %d vs %d", r1.GasUsed, r2.GasUsed)
+	}
+	// 越界的长度在收费之前报错，不会因费用溢出而变成 gas 耗尽
+	huge, _ := Assemble("PUSH 0xffffffffffffffff\nPUSH 0\nLOG0")
+	if _, err := engine.ExecuteTransaction(&common.Transaction{Code: huge, GasLimit: common.DefaultGasLimit}); !errors.Is(err, ErrMemoryOutOfBounds) {
+		t.Errorf("huge log length: got %v, want out of bounds", err)
+	}
+
+	// 回滚的交易与失败的调用都不会留下日志
+	reverted, _ := Assemble("PUSH 0\nPUSH 0\nLOG0\nREVERT")
+	if result, _ := engine.ExecuteTransaction(&common.Transaction{Code: reverted, GasLimit: common.DefaultGasLimit}); len(result.Logs) != 0 {
+		t.Errorf("reverted transaction kept logs %v", result.Logs)
+	}
+	_ = state.Put(CodeKey("reverted"), mustEncode(t, reverted))
+	caller, _ := Assemble("PUSH 0\nPUSH 0\nCALL \"reverted\"")
+	if result, _ := engine.ExecuteTransaction(&common.Transaction{Code: caller, GasLimit: common.DefaultGasLimit}); len(result.Logs) != 0 {
+		t.Errorf("failed call kept logs %v", result.Logs)
+	}
+}
+
+func TestOpcodes(t *testing.T) {
+	const max = ^uint64(0)
+	neg := func(v int64) uint64 { return uint64(v) }
+	tests := []struct {
+		name string
+		src  string
+		want []uint64
+		err  error
+	}{
+		// 无符号算术按 2^64 回绕
+		{name: "add overflow", src: "PUSH 0xffffffffffffffff\nPUSH 2\nADD", want: []uint64{1}},
+		{name: "sub underflow", src: "PUSH 1\nPUSH 2\nSUB", want: []uint64{max}},
+		{name: "mul overflow", src: "PUSH 0x8000000000000000\nPUSH 2\nMUL", want: []uint64{0}},
+		{name: "div", src: "PUSH 7\nPUSH 2\nDIV", want: []uint64{3}},
+		{name: "div by zero", src: "PUSH 7\nPUSH 0\nDIV", err: ErrDivisionByZero},
+		{name: "mod", src: "PUSH 7\nPUSH 3\nMOD", want: []uint64{1}},
+		{name: "mod by zero", src: "PUSH 7\nPUSH 0\nMOD", err: ErrDivisionByZero},
+		{name: "exp", src: "PUSH 3\nPUSH 4\nEXP", want: []uint64{81}},
+		{name: "exp zero", src: "PUSH 0\nPUSH 0\nEXP", want: []uint64{1}},
+		{name: "exp overflow", src: "PUSH 2\nPUSH 64\nEXP", want: []uint64{0}},
+
+		// 有符号算术
+		{name: "sdiv", src: "PUSH 0xfffffffffffffff9\nPUSH 2\nSDIV", want: []uint64{neg(-3)}},
+		{name: "sdiv overflow", src: "PUSH 0x8000000000000000\nPUSH 0xffffffffffffffff\nSDIV", want: []uint64{1 << 63}},
+		{name: "sdiv by zero", src: "PUSH 1\nPUSH 0\nSDIV", err: ErrDivisionByZero},
+		{name: "smod", src: "PUSH 0xfffffffffffffff9\nPUSH 2\nSMOD", want: []uint64{neg(-1)}},
+		{name: "smod min", src: "PUSH 0x8000000000000000\nPUSH 0xffffffffffffffff\nSMOD", want: []uint64{0}},
+
+		// 位运算
+		{name: "and", src: "PUSH 12\nPUSH 10\nAND", want: []uint64{8}},
+		{name: "or", src: "PUSH 12\nPUSH 10\nOR", want: []uint64{14}},
+		{name: "xor", src: "PUSH 12\nPUSH 10\nXOR", want: []uint64{6}},
+		{name: "not", src: "PUSH 0\nNOT", want: []uint64{max}},
+		{name: "shl", src: "PUSH 1\nPUSH 4\nSHL", want: []uint64{16}},
+		{name: "shl out", src: "PUSH 1\nPUSH 64\nSHL", want: []uint64{0}},
+		{name: "shr", src: "PUSH 16\nPUSH 4\nSHR", want: []uint64{1}},
+		{name: "shr out", src: "PUSH 0xffffffffffffffff\nPUSH 100\nSHR", want: []uint64{0}},
+		{name: "sar", src: "PUSH 0xfffffffffffffff0\nPUSH 4\nSAR", want: []uint64{max}},
+		{name: "sar out", src: "PUSH 0x8000000000000000\nPUSH 200\nSAR", want: []uint64{max}},
+		{name: "sar positive", src: "PUSH 0x7000000000000000\nPUSH 200\nSAR", want: []uint64{0}},
+
+		// 比较
+		{name: "lt", src: "PUSH 1\nPUSH 2\nLT", want: []uint64{1}},
+		{name: "gt", src: "PUSH 1\nPUSH 2\nGT", want: []uint64{0}},
+		{name: "slt", src: "PUSH 0xffffffffffffffff\nPUSH 1\nSLT", want: []uint64{1}},
+		{name: "sgt", src: "PUSH 0xffffffffffffffff\nPUSH 1\nSGT", want: []uint64{0}},
+		{name: "eq", src: "PUSH 5\nPUSH 5\nEQ", want: []uint64{1}},
+		{name: "iszero", src: "PUSH 0\nISZERO\nPUSH 3\nISZERO", want: []uint64{1, 0}},
+		{name: "cmp", src: "PUSH 2\nPUSH 1\nCMP", want: []uint64{1}},
+
+		// 栈操作
+		{name: "pop", src: "PUSH 1\nPUSH 2\nPOP", want: []uint64{1}},
+		{name: "dup1", src: "PUSH 1\nDUP1", want: []uint64{1, 1}},
+		{name: "dup3", src: "PUSH 1\nPUSH 2\nPUSH 3\nDUP3", want: []uint64{1, 2, 3, 1}},
+		{name: "swap1", src: "PUSH 1\nPUSH 2\nSWAP1", want: []uint64{2, 1}},
+		{name: "swap2", src: "PUSH 1\nPUSH 2\nPUSH 3\nSWAP2", want: []uint64{3, 2, 1}},
+		{name: "add underflow", src: "ADD", err: ErrStackUnderflow},
+		{name: "overflow", src: "PUSH 1\nloop: DUP1\nJMP loop", err: ErrStackOverflow},
+
+		// 动态跳转
+		{name: "jumpi taken", src: "PUSH 1\nPUSH end\nJUMPI\nPUSH 9\nend: PUSH 7", want: []uint64{7}},
+		{name: "jumpi not taken", src: "PUSH 0\nPUSH end\nJUMPI\nPUSH 9\nend: PUSH 7", want: []uint64{9, 7}},
+		{name: "jumpi to end", src: "PUSH 1\nPUSH 4\nJUMPI\nPUSH 9", want: []uint64{}},
+		{name: "jumpi out of range", src: "PUSH 1\nPUSH 5\nJUMPI\nPUSH 9", err: ErrInvalidJump},
+		{name: "jumpi huge", src: "PUSH 1\nPUSH 0xffffffffffffffff\nJUMPI", err: ErrInvalidJump},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Assemble(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			engine := NewVM(nil)
+			_, err = engine.ExecuteTransaction(&common.Transaction{Code: code, GasLimit: common.DefaultGasLimit})
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := engine.Context.Stack; len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, words(tt.want...))) {
+				t.Errorf("stack %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWordModes(t *testing.T) {
+	const ones = "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+	tests := []struct {
+		name    string
+		size    WordSize
+		checked bool
+		src     string
+		want    []string // 十六进制
+		err     error
+	}{
+		{name: "add carries across limbs", size: Word256, src: "PUSHW 0xffffffffffffffffffffffffffffffff\nPUSH 1\nADD", want: []string{"0x100000000000000000000000000000000"}},
+		{name: "add wraps", size: Word256, src: "PUSHW " + ones + "\nPUSH 1\nADD", want: []string{"0x0"}},
+		{name: "add checked", size: Word256, checked: true, src: "PUSHW " + ones + "\nPUSH 1\nADD", err: ErrArithmeticOverflow},
+		{name: "sub wraps", size: Word256, src: "PUSH 0\nPUSH 1\nSUB", want: []string{ones}},
+		{name: "sub checked", size: Word256, checked: true, src: "PUSH 0\nPUSH 1\nSUB", err: ErrArithmeticOverflow},
+		{name: "mul", size: Word256, src: "PUSHW 0x010000000000000000\nDUP1\nMUL", want: []string{"0x100000000000000000000000000000000"}},
+		{name: "mul wraps", size: Word256, src: "PUSH 1\nPUSH 128\nSHL\nDUP1\nMUL", want: []string{"0x0"}},
+		{name: "mul checked", size: Word256, checked: true, src: "PUSH 1\nPUSH 128\nSHL\nDUP1\nMUL", err: ErrArithmeticOverflow},
+		{name: "exp", size: Word256, src: "PUSH 2\nPUSH 200\nEXP", want: []string{"0x100000000000000000000000000000000000000000000000000"}},
+		{name: "exp checked", size: Word256, checked: true, src: "PUSH 2\nPUSH 256\nEXP", err: ErrArithmeticOverflow},
+		{name: "div", size: Word256, src: "PUSH 1\nPUSH 200\nSHL\nPUSH 1\nPUSH 100\nSHL\nDIV", want: []string{"0x10000000000000000000000000"}},
+		{name: "mod", size: Word256, src: "PUSHW " + ones + "\nPUSH 1000\nMOD", want: []string{"0x3a7"}},
+		{name: "sdiv", size: Word256, src: "PUSH 0\nPUSH 6\nSUB\nPUSH 3\nSDIV", want: []string{"0xfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe"}},
+		{name: "sdiv min checked", size: Word256, checked: true, src: "PUSH 1\nPUSH 255\nSHL\nPUSHW " + ones + "\nSDIV", err: ErrArithmeticOverflow},
+		{name: "slt", size: Word256, src: "PUSHW " + ones + "\nPUSH 1\nSLT", want: []string{"0x1"}},
+		{name: "shl shr", size: Word256, src: "PUSH 1\nPUSH 255\nSHL\nDUP1\nPUSH 254\nSHR", want: []string{"0x8000000000000000000000000000000000000000000000000000000000000000", "0x2"}},
+		{name: "sar", size: Word256, src: "PUSH 1\nPUSH 255\nSHL\nPUSH 300\nSAR", want: []string{ones}},
+		{name: "not", size: Word256, src: "PUSH 0\nNOT", want: []string{ones}},
+		{name: "store and loadw", size: Word256, src: "PUSHW 0x0102030405060708090a0b0c0d0e0f10111213\nSTORE 0\nPOP\nLOADW 0", want: []string{"0x102030405060708090a0b0c0d0e0f10111213"}},
+		{name: "sstore and sload", size: Word256, src: "PUSHW " + ones + "\nPUSHW 0xabcdef0123456789abcdef\nSSTORE \"x\"\nPUSHW 0xabcdef0123456789abcdef\nSLOAD \"x\"", want: []string{ones}},
+
+		// 64 位模式
+		{name: "pushw truncates", size: Word64, src: "PUSHW 0x0100000000000000002a", want: []string{"0x2a"}},
+		{name: "pushw too long", size: Word64, src: "PUSHW 0x" + strings.Repeat("00", 33), err: ErrInvalidOperand},
+		{name: "loadw", size: Word64, src: "PUSH 42\nSTORE 0\nLOADW 0", want: []string{"0x2a", "0x2a"}},
+		{name: "add checked 64", size: Word64, checked: true, src: "PUSH 0xffffffffffffffff\nPUSH 1\nADD", err: ErrArithmeticOverflow},
+		{name: "sub checked 64", size: Word64, checked: true, src: "PUSH 1\nPUSH 2\nSUB", err: ErrArithmeticOverflow},
+		{name: "mul checked 64", size: Word64, checked: true, src: "PUSH 0x100000000\nDUP1\nMUL", err: ErrArithmeticOverflow},
+		{name: "exp checked 64", size: Word64, checked: true, src: "PUSH 2\nPUSH 64\nEXP", err: ErrArithmeticOverflow},
+		{name: "exp fits 64", size: Word64, checked: true, src: "PUSH 2\nPUSH 63\nEXP", want: []string{"0x8000000000000000"}},
+		{name: "sdiv min checked 64", size: Word64, checked: true, src: "PUSH 0x8000000000000000\nPUSH 0xffffffffffffffff\nSDIV", err: ErrArithmeticOverflow},
+		{name: "shr 64", size: Word64, src: "PUSH 1\nPUSH 64\nSHL", want: []string{"0x0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Assemble(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			engine := NewVM(nil)
+			engine.WordSize = tt.size
+			engine.CheckOverflow = tt.checked
+			_, err = engine.ExecuteTransaction(&common.Transaction{Code: code, GasLimit: common.DefaultGasLimit})
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(engine.Context.Stack))
+			for i, w := range engine.Context.Stack {
+				got[i] = w.Hex()
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stack %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Word 的 JSON 编码：能用 uint64 表示时为数字，否则为十六进制字符串
+	in := []Word{common.NewWord(7), {0, 0, 0, 1 << 63}}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[7,"0x8000000000000000000000000000000000000000000000000000000000000000"]` {
+		t.Errorf("json %s", data)
+	}
+	var out []Word
+	if err := json.Unmarshal(data, &out); err != nil || !reflect.DeepEqual(in, out) {
+		t.Errorf("json round trip: %v %v", out, err)
+	}
+	if w := utils.BytesToWord(utils.WordToBytes(in[1])); w != in[1] {
+		t.Errorf("bytes round trip: %s", w.Hex())
+	}
+}
+
+func TestCrypto(t *testing.T) {
+	run := func(src string, size WordSize) (*VM, *ExecutionResult) {
+		t.Helper()
+		code, err := Assemble(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		engine := NewVM(nil)
+		engine.WordSize = size
+		result, err := engine.ExecuteTransaction(&common.Transaction{Code: code, GasLimit: common.DefaultGasLimit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return engine, result
+	}
+
+	digest := sha256.Sum256([]byte("abc"))
+	engine, short := run("STOREI 0 \"abc\"\nPUSH 3\nPUSH 0\nHASH", Word256)
+	if got := engine.Context.Peek(); got != utils.BytesToWord(digest[:]) {
+		t.Errorf("HASH = %s, want %x", got.Hex(), digest)
+	}
+	engine, _ = run("STOREI 0 \"abc\"\nPUSH 3\nPUSH 0\nHASH", Word64)
+	if got := engine.Context.Peek(); got != common.NewWord(utils.BytesToInt(digest[:8])) {
+		t.Errorf("64-bit HASH = %s, want %x", got.Hex(), digest[:8])
+	}
+	_, long := run("MALLOC 64\nPOP\nPUSH 96\nPUSH 0\nHASH", Word256)
+	if long.GasUsed-short.GasUsed != GasAlloc+memoryExpansionGas(32, 96)+GasQuick+2*GasHashWord-GasMemory-GasCopyWord {
+		t.Errorf("hash gas %d vs %d", short.GasUsed, long.GasUsed)
+	}
+	// 越界的长度在收费之前报错，不会因费用溢出而变成 gas 耗尽
+	huge, _ := Assemble("PUSH 0x100000\nPUSH 0\nHASH")
+	if _, err := NewVM(nil).ExecuteTransaction(&common.Transaction{Code: huge, GasLimit: common.DefaultGasLimit}); !errors.Is(err, ErrMemoryOutOfBounds) {
+		t.Errorf("huge hash length: got %v, want out of bounds", err)
+	}
+
+	// 验签：输入为公钥、签名与消息
+	priv := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	msg := []byte("approve transfer #7")
+	input := append(append([]byte(priv.Public().(ed25519.PublicKey)), ed25519.Sign(priv, msg)...), msg...)
+	verify := func(input []byte) uint64 {
+		t.Helper()
+		engine, _ := run(fmt.Sprintf("MALLOC 256\nPOP\nSTOREI 0 0x%x\nPUSH %d\nPUSH 0\nCALL %q", input, len(input), Ed25519Address), Word64)
+		return engine.Context.Peek().Uint64()
+	}
+	if verify(input) != 1 {
+		t.Errorf("valid signature rejected")
+	}
+	tampered := append([]byte{}, input...)
+	tampered[len(tampered)-1] ^= 1
+	if verify(tampered) != 0 {
+		t.Errorf("tampered message accepted")
+	}
+	if verify(input[:40]) != 0 {
+		t.Errorf("short input accepted")
+	}
+}
+
+func TestWork(t *testing.T) {
+	engine := NewVM(nil)
+	gasFor := func(n uint64, limit uint64) (uint64, error) {
+		code := []common.Opcode{{Name: "WORK", Args: []interface{}{n}}}
+		result, err := engine.ExecuteTransaction(&common.Transaction{Code: code, GasLimit: limit})
+		return result.GasUsed, err
+	}
+	for n, want := range map[uint64]uint64{0: GasWork, 1: GasWork + 1, 64: GasWork + 1, 65: GasWork + 2, 6400: GasWork + 100} {
+		if got, err := gasFor(n, common.DefaultGasLimit); err != nil || got != want {
+			t.Errorf("WORK %d: gas %d (%v), want %d", n, got, err, want)
+		}
+	}
+	// 迭代次数超出 gas 上限时在执行前就中止
+	if _, err := gasFor(1<<62, common.DefaultGasLimit); !errors.Is(err, ErrOutOfGas) {
+		t.Errorf("huge WORK: got %v, want out of gas", err)
+	}
+
+	light, err := engine.ExecuteTransaction(common.NewWorkTransaction(0, 1, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	heavy, err := engine.ExecuteTransaction(utils.TxDefMsgToTransaction(&common.TxDefMsg{IdxFrom: 0, IdxTo: 1, Work: 6400}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heavy.GasUsed-light.GasUsed != 2*(100-1) {
+		t.Errorf("gas %d vs %d", light.GasUsed, heavy.GasUsed)
+	}
+
+	// 生成的交易的 gas 上限随 work 增长，走三条 WORK 的分支也不会耗尽 gas
+	_ = engine.State.Put(StorageKey("", []byte("slot"), 0), utils.UintToBytes(200))
+	tx := common.NewWorkTransaction(0, 1, 3500000)
+	if result, err := engine.ExecuteTransaction(tx); err != nil || result.GasUsed > tx.GasLimit {
+		t.Errorf("work 3500000: %v", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	code, _ := Assemble("LOAD 8, 16\nJEQ end, 7\nSTOREI 3 0xcafe\nend:")
+	prog, err := Decode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Instruction{
+		{Op: opcodeTable["LOAD"].id, Uint64: [2]uint64{8, 16}},
+		{Op: opcodeTable["JEQ"].id, Uint64: [2]uint64{7}, Target: 3},
+		{Op: opcodeTable["STOREI"].id, Uint64: [2]uint64{3}, Bytes: []byte{0xca, 0xfe}},
+	}
+	if !reflect.DeepEqual(prog.Instructions, want) {
+		t.Errorf("decoded %+v, want %+v", prog.Instructions, want)
+	}
+	for i, op := range operations {
+		if int(op.id) != i || opcodeTable[op.name].id != op.id {
+			t.Fatalf("operation %d (%s) has id %d", i, op.name, op.id)
+		}
+	}
+
+	if _, err := Decode([]common.Opcode{{Name: "NOPE"}}); !errors.Is(err, ErrUnknownOpcode) {
+		t.Errorf("unknown opcode: got %v", err)
+	}
+	if _, err := Decode([]common.Opcode{{Name: "PUSH", Args: []interface{}{7}}}); !errors.Is(err, ErrInvalidOperand) {
+		t.Errorf("int operand for PUSH: got %v", err)
+	}
+	// 原先在执行到时才会因类型断言失败而出错，现在在执行前就被拒绝
+	engine := NewVM(nil)
+	tx := &common.Transaction{Code: []common.Opcode{{Name: "REVERT"}, {Name: "PUSH"}}, GasLimit: common.DefaultGasLimit}
+	if _, err := engine.ExecuteTransaction(tx); !errors.Is(err, ErrInvalidOperand) {
+		t.Errorf("malformed program: got %v", err)
+	}
+}
+
+func words(values ...uint64) []Word {
+	ws := make([]Word, len(values))
+	for i, v := range values {
+		ws[i] = common.NewWord(v)
+	}
+	return ws
+}
+
+func mustEncode(t *testing.T, code []common.Opcode) []byte {
+	t.Helper()
+	b, err := common.EncodeCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// 扩展操作码在包初始化时注册，与扩展包的用法相同，也使 go test -count=N 可以重复运行
+func init() {
+	// MULADD k：弹出 a、b，压入 b*a+k
+	err := RegisterOpcode("MULADD", func(ctx *Context, in *Instruction) error {
+		a, b := ctx.PopUint64(), ctx.PopUint64()
+		ctx.Push(common.NewWord(b*a + in.Uint64[0]))
+		return nil
+	}, GasFast, 2, 1, ArgUint64)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterOpcode(t *testing.T) {
+	code, err := Assemble("PUSH 6\nPUSH 7\nmuladd 8\nSTORE 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(code); err != nil {
+		t.Fatal(err)
+	}
+	data, err := common.EncodeCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := common.DecodeCode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := NewVM(make([]byte, 8))
+	result, err := engine.ExecuteTransaction(&common.Transaction{Code: decoded, GasLimit: common.DefaultGasLimit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := utils.BytesToInt(engine.Context.Memory.Cell); got != 50 {
+		t.Errorf("MULADD: got %d, want 50", got)
+	}
+	if want := 2*GasQuick + GasFast + GasMemory + GasCopyWord; result.GasUsed != want {
+		t.Errorf("gas used %d, want %d", result.GasUsed, want)
+	}
+	if src, _ := Disassemble(code); !strings.Contains(src, "MULADD 8") {
+		t.Errorf("disassembly %q lacks MULADD", src)
+	}
+
+	code, _ = Assemble("PUSH 1\nMULADD 0")
+	if err := Verify(code); !errors.Is(err, ErrStackUnderflow) {
+		t.Errorf("underflow: got %v", err)
+	}
+
+	noop := func(ctx *Context, in *Instruction) error { return nil }
+	cases := []struct {
+		name   string
+		opcode string
+		action OpAction
+		in     int
+		args   []ArgKind
+		want   error
+	}{
+		{"duplicate extension", "MULADD", noop, 0, nil, ErrOpcodeExists},
+		{"duplicate builtin", "ADD", noop, 0, nil, ErrOpcodeExists},
+		{"lower case", "muladd2", noop, 0, nil, ErrInvalidOpcodeDef},
+		{"empty name", "", noop, 0, nil, ErrInvalidOpcodeDef},
+		{"nil handler", "NOHANDLER", nil, 0, nil, ErrInvalidOpcodeDef},
+		{"negative stack", "NEGATIVE", noop, -1, nil, ErrInvalidOpcodeDef},
+		{"too many operands", "WIDE", noop, 0, []ArgKind{ArgBytes, ArgBytes}, ErrInvalidOpcodeDef},
+	}
+	for _, c := range cases {
+		if err := RegisterOpcode(c.opcode, c.action, GasQuick, c.in, 0, c.args...); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+	if _, ok := opcodeTable["NOHANDLER"]; ok {
+		t.Error("rejected opcode was registered")
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	engine := NewVM(nil)
+	engine.WordSize = Word256
+	assemble := func(src string) []common.Opcode {
+		t.Helper()
+		code, err := Assemble(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+	deployed, err := engine.ExecuteTransaction(&common.Transaction{
+		Type:     common.TxDeploy,
+		Code:     assemble("PUSH 1\nPUSH 0\nCALLDATALOAD\nSSTORE \"x\""),
+		GasLimit: common.DefaultGasLimit,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract := deployed.ContractAddress
+	five := make([]byte, 32)
+	five[31] = 5
+	_ = engine.State.Put("target[0]", utils.UintToBytes(6))
+
+	cases := []struct {
+		name string
+		tx   *common.Transaction
+		want string
+	}{
+		{"call data slots", common.NewTransaction(1, 2), "reads [slot[1]], writes [slot[2]]"},
+		{"slot from state", &common.Transaction{Code: assemble("PUSH 0\nSLOAD \"idx\"\nDUP\nSLOAD \"slot\"\nSWAP1\nSSTORE \"slot\"")},
+			"reads [idx[0] slot[*], writes [slot[*]"},
+		{"branch not taken", &common.Transaction{Code: assemble("PUSH 1\nJEQ skip, 1\nPUSH 0\nSSTORE \"never\"\nskip:\nPOP")},
+			"reads [], writes []"},
+		{"dynamic jump", &common.Transaction{Code: assemble("PUSH 1\nPUSH 0\nSLOAD \"target\"\nJUMPI\nREVERT\nPUSH 7\nPUSH 3\nSSTORE \"hidden\"")},
+			// 跳转可能落在任何指令上，包括直接跳到 SLOAD 与 SSTORE，槽位因此都未知
+			"reads [target[* target[0]], writes [hidden[*]"},
+		{"invoke", &common.Transaction{Type: common.TxInvoke, To: contract, Data: five},
+			fmt.Sprintf("reads [code/%s], writes [%s/x[5]]", contract, contract)},
+		{"call", &common.Transaction{Code: assemble(fmt.Sprintf("PUSH 0\nPUSH 0\nCALL %q", contract))},
+			fmt.Sprintf("reads [code/%s], writes [%s/x[*]", contract, contract)},
+		{"deploy", &common.Transaction{Type: common.TxDeploy, Code: assemble("PUSH 2")}, ""},
+		{"extension opcode", &common.Transaction{Code: assemble("PUSH 2\nPUSH 3\nMULADD 1\nPOP")}, "any"},
+		// 抽象栈超过 MaxStackDepth 或工作量超过 MaxAnalysisWork 时停止分析
+		{"huge load", &common.Transaction{Code: assemble("LOAD 0 134217728")}, "any"},
+		{"stack overflow", &common.Transaction{Code: assemble(strings.Repeat("PUSH 1\n", 20000))}, "any"},
+		{"work limit", &common.Transaction{Code: assemble("LOAD 0 8000\n" + strings.Repeat("DUP\nPOP\n", 2000))}, "any"},
+	}
+	for _, c := range cases {
+		set, err := engine.Analyze(c.tx)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if c.name == "deploy" {
+			// engine 已经部署过 contract，这是发送方的第二次部署
+			keys := CodeKey(ContractAddress(engine.Block.Caller, 1, engine.Block.TxHash)) + " " + NonceKey(engine.Block.Caller)
+			c.want = fmt.Sprintf("reads [%s], writes [%s]", keys, keys)
+		}
+		if got := set.String(); got != c.want {
+			t.Errorf("%s: %s, want %s", c.name, got, c.want)
+		}
+		// 预测必须覆盖实际执行的读写集
+		c.tx.GasLimit = common.DefaultGasLimit
+		result, _ := NewVMWithState(NewOverlayState(engine.State)).ExecuteTransaction(c.tx)
+		if !set.Covers(result.StateReadSet, result.StateWriteSet) {
+			t.Errorf("%s: %s does not cover reads %v, writes %v", c.name, set, result.StateReadSet, result.StateWriteSet)
+		}
+	}
+
+	analyze := func(from, to int) *AccessSet {
+		set, err := engine.Analyze(common.NewTransaction(from, to))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return set
+	}
+	if !analyze(1, 2).Conflicts(analyze(2, 3)) || !analyze(1, 2).Conflicts(analyze(0, 2)) {
+		t.Error("transactions sharing a slot should conflict")
+	}
+	if analyze(1, 2).Conflicts(analyze(3, 4)) || analyze(1, 2).Conflicts(analyze(1, 3)) {
+		t.Error("transactions touching different slots or only reading the same one should not conflict")
 	}
-	t.Logf("ret: %x", engine.Context.Peek())
-	t.Logf("mem: %x", utils.LongBytesToInt(engine.Context.Memory.Cell))
 }
@@ -0,0 +1,206 @@
+package vm
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"math/bits"
+	"neochain/common"
+	"neochain/utils"
+)
+
+// Word 是栈上的一个元素
+type Word = common.Word
+
+// WordSize 是栈元素的位宽
+type WordSize int
+
+const (
+	Word64  WordSize = 64  // 默认模式，与 uint64 栈的行为一致
+	Word256 WordSize = 256 // 余额、哈希等可以直接放在一个栈元素中
+)
+
+// ErrArithmeticOverflow 在开启溢出检查时，由结果超出位宽的算术操作码返回
+var ErrArithmeticOverflow = errors.New("arithmetic overflow")
+
+// bits 返回位宽，未设置时为 64 位
+func (s WordSize) bits() uint {
+	if s == Word256 {
+		return 256
+	}
+	return 64
+}
+
+// mask 将 w 截断到当前位宽，即按 2^位宽 取模
+func (c *Context) mask(w Word) Word {
+	if c.wordSize == Word256 {
+		return w
+	}
+	return Word{w[0]}
+}
+
+// fits 判断 w 能否不经截断地放入当前位宽
+func (c *Context) fits(w Word) bool {
+	return c.wordSize == Word256 || w.IsUint64()
+}
+
+// signExtend 把当前位宽下的补码值扩展为 256 位补码
+func (c *Context) signExtend(w Word) Word {
+	if c.wordSize == Word256 {
+		return w
+	}
+	if int64(w[0]) < 0 {
+		return Word{w[0], math.MaxUint64, math.MaxUint64, math.MaxUint64}
+	}
+	return Word{w[0]}
+}
+
+// pushArith 压入算术结果；overflow 表示真实结果超出了位宽，开启溢出检查时返回 ErrArithmeticOverflow，否则回绕
+func (c *Context) pushArith(w Word, overflow bool) error {
+	if overflow || !c.fits(w) {
+		if c.checked {
+			return ErrArithmeticOverflow
+		}
+	}
+	c.Push(c.mask(w))
+	return nil
+}
+
+// pushSigned 压入有符号算术结果，结果超出当前位宽的有符号范围时按 pushArith 的规则处理
+func (c *Context) pushSigned(r *big.Int) error {
+	limit := new(big.Int).Lsh(big.NewInt(1), c.wordSize.bits()-1)
+	overflow := r.Cmp(limit) >= 0 || r.Cmp(new(big.Int).Neg(limit)) < 0
+	return c.pushArith(c.mask(common.WordFromBig(r)), overflow)
+}
+
+// wordBytes 返回 w 在内存与状态中的字节表示，64 位模式为 8 字节，256 位模式为 32 字节
+func (c *Context) wordBytes(w Word) []byte {
+	if c.wordSize == Word256 {
+		return utils.WordToBytes(w)
+	}
+	return utils.UintToBytes(w[0])
+}
+
+// wordFromBytes 是 wordBytes 的逆过程
+func (c *Context) wordFromBytes(b []byte) Word {
+	if c.wordSize == Word256 {
+		return utils.BytesToWord(b)
+	}
+	return common.NewWord(utils.BytesToInt(b))
+}
+
+// signedBig 将 256 位补码转换为有符号大整数
+func signedBig(w Word) *big.Int {
+	b := w.Big()
+	if isNegative(w) {
+		b.Sub(b, new(big.Int).Lsh(big.NewInt(1), 256))
+	}
+	return b
+}
+
+func isNegative(w Word) bool {
+	return int64(w[3]) < 0
+}
+
+func add256(a, b Word) (r Word, carry bool) {
+	var c uint64
+	for i := 0; i < 4; i++ {
+		r[i], c = bits.Add64(a[i], b[i], c)
+	}
+	return r, c != 0
+}
+
+func sub256(a, b Word) (r Word, borrow bool) {
+	var c uint64
+	for i := 0; i < 4; i++ {
+		r[i], c = bits.Sub64(a[i], b[i], c)
+	}
+	return r, c != 0
+}
+
+// mul256 返回 a*b 的低 256 位，overflow 表示乘积超过 256 位
+func mul256(a, b Word) (Word, bool) {
+	var p [8]uint64
+	for i := 0; i < 4; i++ {
+		var carry uint64
+		for j := 0; j < 4; j++ {
+			hi, lo := bits.Mul64(a[i], b[j])
+			var c uint64
+			lo, c = bits.Add64(lo, p[i+j], 0)
+			hi += c
+			lo, c = bits.Add64(lo, carry, 0)
+			hi += c
+			p[i+j] = lo
+			carry = hi
+		}
+		p[i+4] = carry
+	}
+	return Word{p[0], p[1], p[2], p[3]}, p[4]|p[5]|p[6]|p[7] != 0
+}
+
+// cmp256 按无符号比较 a 与 b，返回 -1、0 或 1
+func cmp256(a, b Word) int {
+	for i := 3; i >= 0; i-- {
+		if a[i] < b[i] {
+			return -1
+		}
+		if a[i] > b[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+// lsh256 返回 w 左移 n 位的结果，n 不小于 256 时为 0
+func lsh256(w Word, n uint64) Word {
+	var r Word
+	if n >= 256 {
+		return r
+	}
+	limbs, shift := int(n/64), n%64
+	for i := 3; i >= limbs; i-- {
+		r[i] = w[i-limbs] << shift
+		if shift > 0 && i-limbs-1 >= 0 {
+			r[i] |= w[i-limbs-1] >> (64 - shift)
+		}
+	}
+	return r
+}
+
+// rsh256 返回 w 逻辑右移 n 位的结果，n 不小于 256 时为 0
+func rsh256(w Word, n uint64) Word {
+	var r Word
+	if n >= 256 {
+		return r
+	}
+	limbs, shift := int(n/64), n%64
+	for i := 0; i+limbs < 4; i++ {
+		r[i] = w[i+limbs] >> shift
+		if shift > 0 && i+limbs+1 < 4 {
+			r[i] |= w[i+limbs+1] << (64 - shift)
+		}
+	}
+	return r
+}
+
+// bitLen256 返回表示 w 所需的最少位数
+func bitLen256(w Word) int {
+	for i := 3; i >= 0; i-- {
+		if w[i] != 0 {
+			return 64*i + bits.Len64(w[i])
+		}
+	}
+	return 0
+}
+
+func not256(w Word) Word {
+	return Word{^w[0], ^w[1], ^w[2], ^w[3]}
+}
+
+// shiftAmount 返回移位位数，超出 uint64 的值视为 MaxUint64
+func shiftAmount(w Word) uint64 {
+	if !w.IsUint64() {
+		return math.MaxUint64
+	}
+	return w[0]
+}
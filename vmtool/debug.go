@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"neochain/common"
+	"neochain/vm"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const debugHelp = `commands:
+  s, step              execute the next instruction
+  c, continue          run until the next breakpoint
+  b, break [pc]        set a breakpoint at pc, or list breakpoints
+  d, delete pc         delete the breakpoint at pc
+  st, stack            print the stack, top first
+  m, mem [off [len]]   dump memory
+  w, where             print the next instruction
+  q, quit              abort execution
+  h, help              print this help`
+
+// debugger 是一个交互式单步调试器，通过 vm.Tracer 接口挂到 VM 上
+type debugger struct {
+	in          *bufio.Scanner
+	out         io.Writer
+	code        []common.Opcode
+	breakpoints map[int]bool
+	stepping    bool
+}
+
+func (d *debugger) OnStep(ctx *vm.Context, op common.Opcode, cost uint64) {
+	if !d.stepping && !d.breakpoints[ctx.PC] {
+		return
+	}
+	if d.breakpoints[ctx.PC] && !d.stepping {
+		fmt.Fprintf(d.out, "breakpoint at pc %d\n", ctx.PC)
+	}
+	d.where(ctx, op, cost)
+	for {
+		fmt.Fprint(d.out, "(vmdb) ")
+		if !d.in.Scan() {
+			os.Exit(0)
+		}
+		fields := strings.Fields(d.in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "s", "step":
+			d.stepping = true
+			return
+		case "c", "continue":
+			d.stepping = false
+			return
+		case "b", "break":
+			if len(fields) == 1 {
+				for pc := range d.breakpoints {
+					fmt.Fprintf(d.out, "  pc %d\n", pc)
+				}
+				continue
+			}
+			if pc, ok := d.parsePC(fields[1]); ok {
+				d.breakpoints[pc] = true
+			}
+		case "d", "delete":
+			if len(fields) == 2 {
+				if pc, ok := d.parsePC(fields[1]); ok {
+					delete(d.breakpoints, pc)
+				}
+			}
+		case "st", "stack":
+			for i := len(ctx.Stack) - 1; i >= 0; i-- {
+				fmt.Fprintf(d.out, "  [%d] %s (%s)\n", len(ctx.Stack)-1-i, ctx.Stack[i], ctx.Stack[i].Hex())
+			}
+		case "m", "mem":
+			d.dumpMemory(ctx, fields[1:])
+		case "w", "where":
+			d.where(ctx, op, cost)
+		case "q", "quit":
+			os.Exit(1)
+		case "h", "help":
+			fmt.Fprintln(d.out, debugHelp)
+		default:
+			fmt.Fprintf(d.out, "unknown command %q, type h for help\n", fields[0])
+		}
+	}
+}
+
+func (d *debugger) OnMemoryWrite(offset uint64, data []byte) {
+	if d.stepping {
+		fmt.Fprintf(d.out, "  mem[%d:%d] = %x\n", offset, offset+uint64(len(data)), data)
+	}
+}
+
+func (d *debugger) OnError(ctx *vm.Context, err error) {
+	fmt.Fprintf(d.out, "error at pc %d: %v\n", ctx.PC, err)
+}
+
+func (d *debugger) OnExit(result *vm.ExecutionResult, err error) {
+	fmt.Fprintf(d.out, "exit: gas used %d\n", result.GasUsed)
+}
+
+func (d *debugger) where(ctx *vm.Context, op common.Opcode, cost uint64) {
+	frame := ""
+	if ctx.Depth() > 0 {
+		frame = fmt.Sprintf("[call depth %d, %s] ", ctx.Depth(), ctx.Address)
+	}
+	fmt.Fprintf(d.out, "%spc %d: %s (cost %d, gas left %d)\n", frame, ctx.PC, vm.FormatOpcode(op), cost, ctx.Gas)
+}
+
+func (d *debugger) parsePC(s string) (int, bool) {
+	pc, err := strconv.Atoi(s)
+	if err != nil || pc < 0 || pc >= len(d.code) {
+		fmt.Fprintf(d.out, "invalid pc %q\n", s)
+		return 0, false
+	}
+	return pc, true
+}
+
+func (d *debugger) dumpMemory(ctx *vm.Context, args []string) {
+	cell := ctx.Memory.Cell
+	offset, length := uint64(0), uint64(len(cell))
+	var err error
+	if len(args) > 0 {
+		if offset, err = strconv.ParseUint(args[0], 0, 64); err != nil {
+			fmt.Fprintf(d.out, "invalid offset %q\n", args[0])
+			return
+		}
+		length = 32
+	}
+	if len(args) > 1 {
+		if length, err = strconv.ParseUint(args[1], 0, 64); err != nil {
+			fmt.Fprintf(d.out, "invalid length %q\n", args[1])
+			return
+		}
+	}
+	if offset > uint64(len(cell)) {
+		offset = uint64(len(cell))
+	}
+	if offset+length > uint64(len(cell)) {
+		length = uint64(len(cell)) - offset
+	}
+	fmt.Fprint(d.out, hex.Dump(cell[offset:offset+length]))
+}
+
+// runDebug 在交互式调试器中执行程序
+func runDebug(args []string) error {
+	fs := flag.NewFlagSet("debug", flag.ExitOnError)
+	opts := addRunFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: vmtool debug [-gas n] [-mem hex] [-data hex] prog.asm|prog.bin")
+	}
+	tx, engine, err := opts.load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Println("type h for help")
+	engine.Tracer = &debugger{
+		in:          bufio.NewScanner(os.Stdin),
+		out:         os.Stdout,
+		code:        tx.Code,
+		breakpoints: make(map[int]bool),
+		stepping:    true,
+	}
+	_, _ = engine.ExecuteTransaction(tx)
+	return nil
+}
+
+// runTrace 执行程序并将 JSON 格式的追踪写到标准输出
+func runTrace(args []string) error {
+	fs := flag.NewFlagSet("trace", flag.ExitOnError)
+	opts := addRunFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: vmtool trace [-gas n] [-mem hex] [-data hex] prog.asm|prog.bin")
+	}
+	tx, engine, err := opts.load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	engine.Tracer = vm.NewJSONTracer(os.Stdout)
+	_, _ = engine.ExecuteTransaction(tx)
+	return nil
+}
+
+type runFlags struct {
+	gas       *uint64
+	mem       *string
+	data      *string
+	maxMemory *uint64
+	word256   *bool
+	checked   *bool
+}
+
+func addRunFlags(fs *flag.FlagSet) runFlags {
+	return runFlags{
+		gas:       fs.Uint64("gas", common.DefaultGasLimit, "gas limit"),
+		mem:       fs.String("mem", "", "initial memory as hex"),
+		data:      fs.String("data", "", "call data as hex"),
+		maxMemory: fs.Uint64("max-memory", vm.DefaultMaxMemory, "memory size limit in bytes, 0 for unlimited"),
+		word256:   fs.Bool("word256", false, "use 256-bit stack words"),
+		checked:   fs.Bool("checked", false, "abort on arithmetic overflow instead of wrapping"),
+	}
+}
+
+// load 读取程序并创建执行它的 VM
+func (o runFlags) load(path string) (*common.Transaction, *vm.VM, error) {
+	code, err := loadProgram(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	mem, err := hex.DecodeString(*o.mem)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid -mem: %v", err)
+	}
+	data, err := hex.DecodeString(*o.data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid -data: %v", err)
+	}
+	engine := vm.NewVM(mem)
+	if *o.word256 {
+		engine.WordSize = vm.Word256
+	}
+	engine.CheckOverflow = *o.checked
+	engine.MaxMemory = *o.maxMemory
+	return &common.Transaction{Code: code, GasLimit: *o.gas, Data: data}, engine, nil
+}
+
+// loadProgram 读取 .asm 汇编源码或二进制字节码
+func loadProgram(path string) ([]common.Opcode, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".asm") {
+		code, err := vm.Assemble(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return code, nil
+	}
+	return common.DecodeCode(data)
+}
@@ -0,0 +1,148 @@
+// Binary vmtool 是面向合约作者的 VM 工具集。
+//
+//	vmtool asm [-o out.bin] prog.asm   将汇编源码编译为二进制字节码
+//	vmtool compile [-o out.bin] [-S] prog.nc  将合约语言源码编译为二进制字节码，-S 时输出汇编源码
+//	vmtool disasm prog.bin             将二进制字节码反汇编为汇编源码
+//	vmtool trace prog.asm|prog.bin     执行程序并输出 JSON lines 格式的追踪
+//	vmtool debug prog.asm|prog.bin     在交互式单步调试器中执行程序
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"neochain/common"
+	"neochain/lang"
+	"neochain/vm"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	run   func(args []string) error
+	usage string
+}
+
+var commands = map[string]command{
+	"asm":     {runAsm, "asm [-o out.bin] prog.asm"},
+	"compile": {runCompile, "compile [-o out.bin] [-S] prog.nc"},
+	"disasm":  {runDisasm, "disasm prog.bin"},
+	"trace":   {runTrace, "trace [-gas n] [-mem hex] [-data hex] prog.asm|prog.bin"},
+	"debug":   {runDebug, "debug [-gas n] [-mem hex] [-data hex] prog.asm|prog.bin"},
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		log.Fatalf("%s: %v", os.Args[1], err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  vmtool %s\n", commands[name].usage)
+	}
+	os.Exit(2)
+}
+
+func runAsm(args []string) error {
+	fs := flag.NewFlagSet("asm", flag.ExitOnError)
+	out := fs.String("o", "", "output file, defaults to the input name with a .bin extension")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: vmtool asm [-o out.bin] prog.asm")
+	}
+
+	src, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	code, err := vm.Assemble(string(src))
+	if err != nil {
+		return fmt.Errorf("%s: %v", fs.Arg(0), err)
+	}
+	if err := vm.Verify(code); err != nil {
+		return fmt.Errorf("%s: %v", fs.Arg(0), err)
+	}
+	bin, err := common.EncodeCode(code)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(fs.Arg(0), filepath.Ext(fs.Arg(0))) + ".bin"
+	}
+	return os.WriteFile(*out, bin, 0644)
+}
+
+func runCompile(args []string) error {
+	fs := flag.NewFlagSet("compile", flag.ExitOnError)
+	out := fs.String("o", "", "output file, defaults to the input name with a .bin extension, or .asm with -S")
+	asm := fs.Bool("S", false, "write assembly source instead of bytecode")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: vmtool compile [-o out.bin] [-S] prog.nc")
+	}
+
+	src, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(fs.Arg(0), filepath.Ext(fs.Arg(0)))
+	if *asm {
+		text, err := lang.CompileAsm(string(src))
+		if err != nil {
+			return fmt.Errorf("%s:%v", fs.Arg(0), err)
+		}
+		if *out == "" {
+			*out = base + ".asm"
+		}
+		return os.WriteFile(*out, []byte(text), 0644)
+	}
+	code, err := lang.Compile(string(src))
+	if err != nil {
+		return fmt.Errorf("%s:%v", fs.Arg(0), err)
+	}
+	bin, err := common.EncodeCode(code)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = base + ".bin"
+	}
+	return os.WriteFile(*out, bin, 0644)
+}
+
+func runDisasm(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: vmtool disasm prog.bin")
+	}
+	bin, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	code, err := common.DecodeCode(bin)
+	if err != nil {
+		return err
+	}
+	src, err := vm.Disassemble(code)
+	if err != nil {
+		return err
+	}
+	fmt.Print(src)
+	return nil
+}